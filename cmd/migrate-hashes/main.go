@@ -0,0 +1,466 @@
+// Command migrate-hashes rewrites phone hashes to the current keyed hash: the
+// hash field of records in the Airtable Partial and R2E tables, the latter
+// named by AIRTABLE_R2E_HASH_FIELD, the keys of stored opt-outs and finished
+// registrations, the phone hash of tracked messages, reminder sequence
+// progress and the contacts in scheduled jobs.
+//
+// Partial records are rehashed from their phone field. Everything else is
+// rehashed from its own phone field if it has one, otherwise by matching its
+// old hash to a Partial record. Rate limit counters aren't migrated as they
+// expire within their window. Stop the server while it runs, since jobs it
+// has claimed are skipped. Run with -dry-run first to see what would change.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+
+	"sample-golang/pkg/clients/airtable"
+	"sample-golang/pkg/config"
+	"sample-golang/pkg/consent"
+	"sample-golang/pkg/database"
+	"sample-golang/pkg/delivery"
+	"sample-golang/pkg/docstore"
+	"sample-golang/pkg/phone"
+	"sample-golang/pkg/registration"
+	"sample-golang/pkg/scheduler"
+	"sample-golang/pkg/utils"
+	"sample-golang/pkg/workflow"
+)
+
+// partialHashField names the Partial table column holding phone hashes
+const partialHashField = "hash"
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "report changes without writing them to Airtable or the stores")
+	flag.Parse()
+
+	if err := godotenv.Load(); err != nil {
+		log.Println("Error loading .env file")
+	}
+
+	cfg := config.LoadConfig()
+	if err := phone.SetDefaultRegion(cfg.PhoneRegion); err != nil {
+		log.Fatalf("Error configuring phone numbers: %v", err)
+	}
+	if len(cfg.PhoneHashKeys) == 0 {
+		log.Fatal("PHONE_HASH_KEYS must be set to migrate hashes")
+	}
+
+	hasher, err := utils.NewPhoneHasher(cfg.PhoneHashKeys, true)
+	if err != nil {
+		log.Fatalf("Error initializing phone hasher: %v", err)
+	}
+
+	ctx := context.Background()
+	client := airtable.NewClient(cfg.AirtableAPIKey, cfg.AirtableBaseID, cfg.AirtableRate)
+
+	partial, err := client.ListRecords(ctx, cfg.AirtablePartialTable)
+	if err != nil {
+		log.Fatalf("Error listing Partial records: %v", err)
+	}
+
+	// Map every hash a Partial record is known by to its number so R2E records can be matched
+	numbers := make(map[string]string)
+	for _, record := range partial {
+		number, ok := recordNumber(record)
+		if !ok {
+			continue
+		}
+		if hash, _ := record.Fields[partialHashField].(string); hash != "" {
+			numbers[hash] = number
+		}
+		for _, candidate := range hasher.Candidates(number) {
+			numbers[candidate] = number
+		}
+	}
+
+	migrate(ctx, client, cfg.AirtablePartialTable, partialHashField, partial, numbers, hasher, *dryRun)
+
+	r2e, err := client.ListRecords(ctx, cfg.AirtableR2ETable)
+	if err != nil {
+		log.Fatalf("Error listing R2E records: %v", err)
+	}
+	migrate(ctx, client, cfg.AirtableR2ETable, cfg.AirtableR2EHashField, r2e, numbers, hasher, *dryRun)
+
+	documents, jobs, err := openStores(cfg)
+	if err != nil {
+		log.Fatalf("Error opening stores: %v", err)
+	}
+	migrateConsent(consent.NewStore(documents), numbers, hasher, *dryRun)
+	migrateRegistrations(registration.NewStore(documents), numbers, hasher, *dryRun)
+	migrateMessages(delivery.NewStore(documents), numbers, hasher, *dryRun)
+	migrateProgress(workflow.NewStore(documents), numbers, hasher, *dryRun)
+	migrateJobs(jobs, numbers, hasher, *dryRun)
+}
+
+// openStores opens the document and job stores the server is configured to use
+func openStores(cfg *config.Config) (docstore.Backend, scheduler.Store, error) {
+	if cfg.Store == "file" {
+		documents, err := docstore.NewFileBackend(cfg.DataDir)
+		if err != nil {
+			return nil, nil, err
+		}
+		return documents, scheduler.NewDocStore(documents), nil
+	}
+	if cfg.DatabaseURL == "" {
+		return nil, nil, errors.New("DATABASE_URL is not set")
+	}
+
+	db, err := database.Open(cfg.DatabaseURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	documents, err := docstore.NewSQLBackend(db)
+	if err != nil {
+		return nil, nil, err
+	}
+	jobs, err := scheduler.NewSQLStore(db)
+	if err != nil {
+		return nil, nil, err
+	}
+	return documents, jobs, nil
+}
+
+// rehash returns the current hash of the number an old hash belongs to, or
+// the value as it is if it isn't a known hash
+func rehash(value string, numbers map[string]string, hasher utils.PhoneHasher) string {
+	if number, ok := numbers[value]; ok {
+		return hasher.Hash(number)
+	}
+	return value
+}
+
+// migrateConsent moves each opt-out to the current hash of its number. A
+// record already under the current hash is newer, so it is kept.
+func migrateConsent(store consent.Store, numbers map[string]string, hasher utils.PhoneHasher, dryRun bool) {
+	records, err := store.List()
+	if err != nil {
+		log.Fatalf("Error listing opt-outs: %v", err)
+	}
+
+	moved, unchanged, unmatched := 0, 0, 0
+	for hash, record := range records {
+		number, ok := numbers[hash]
+		if !ok {
+			log.Printf("Skipping opt-out %s: no phone number found", hash)
+			unmatched++
+			continue
+		}
+
+		newHash := hasher.Hash(number)
+		if newHash == hash {
+			unchanged++
+			continue
+		}
+
+		moved++
+		if dryRun {
+			continue
+		}
+		if _, exists := records[newHash]; !exists {
+			if err := store.SetOptedOut(newHash, record.OptedOut); err != nil {
+				log.Fatalf("Error saving opt-out %s: %v", newHash, err)
+			}
+		}
+		if err := store.Delete(hash); err != nil {
+			log.Fatalf("Error deleting opt-out %s: %v", hash, err)
+		}
+	}
+
+	report(fmt.Sprintf("opt-outs: %d to move, %d already current, %d unmatched", moved, unchanged, unmatched), dryRun)
+}
+
+// migrateRegistrations moves each finished registration to the current hash of
+// its number, keeping one already recorded there
+func migrateRegistrations(store registration.Store, numbers map[string]string, hasher utils.PhoneHasher, dryRun bool) {
+	records, err := store.List()
+	if err != nil {
+		log.Fatalf("Error listing registrations: %v", err)
+	}
+
+	moved, unchanged, unmatched := 0, 0, 0
+	for hash, record := range records {
+		if _, ok := numbers[hash]; !ok {
+			unmatched++
+			continue
+		}
+		newHash := rehash(hash, numbers, hasher)
+		if newHash == hash {
+			unchanged++
+			continue
+		}
+
+		moved++
+		if dryRun {
+			continue
+		}
+		if err := store.MarkComplete(newHash, record); err != nil {
+			log.Fatalf("Error saving registration %s: %v", newHash, err)
+		}
+		if err := store.Delete(hash); err != nil {
+			log.Fatalf("Error deleting registration %s: %v", hash, err)
+		}
+	}
+
+	report(fmt.Sprintf("registrations: %d to move, %d already current, %d unmatched", moved, unchanged, unmatched), dryRun)
+}
+
+// migrateProgress moves each contact's reminder sequence progress to the
+// current hash. Progress already under the current hash is newer, so it is kept.
+func migrateProgress(store workflow.Store, numbers map[string]string, hasher utils.PhoneHasher, dryRun bool) {
+	progress, err := store.List()
+	if err != nil {
+		log.Fatalf("Error listing sequence progress: %v", err)
+	}
+
+	moved, unchanged, unmatched := 0, 0, 0
+	for _, p := range progress {
+		if _, ok := numbers[p.ContactKey]; !ok {
+			unmatched++
+			continue
+		}
+		newKey := rehash(p.ContactKey, numbers, hasher)
+		if newKey == p.ContactKey {
+			unchanged++
+			continue
+		}
+
+		moved++
+		if dryRun {
+			continue
+		}
+		_, err := store.Get(newKey, p.Sequence)
+		switch {
+		case errors.Is(err, workflow.ErrProgressNotFound):
+			oldKey := p.ContactKey
+			p.ContactKey = newKey
+			if err := store.Save(p); err != nil {
+				log.Fatalf("Error saving progress for %s: %v", newKey, err)
+			}
+			p.ContactKey = oldKey
+		case err != nil:
+			log.Fatalf("Error loading progress for %s: %v", newKey, err)
+		}
+		if err := store.Delete(p.ContactKey, p.Sequence); err != nil {
+			log.Fatalf("Error deleting progress for %s: %v", p.ContactKey, err)
+		}
+	}
+
+	report(fmt.Sprintf("sequence progress: %d to move, %d already current, %d unmatched", moved, unchanged, unmatched), dryRun)
+}
+
+// migrateJobs rewrites the hashes in scheduled jobs' keys and payloads, such
+// as a reminder's phone hash, consent key and lookup hashes, so jobs still
+// find the contact's progress and records once they have moved
+func migrateJobs(store scheduler.Store, numbers map[string]string, hasher utils.PhoneHasher, dryRun bool) {
+	jobs, err := store.List()
+	if err != nil {
+		log.Fatalf("Error listing scheduled jobs: %v", err)
+	}
+
+	updated, unchanged, claimed := 0, 0, 0
+	now := time.Now()
+	for _, job := range jobs {
+		// Keys are made of "/"-separated parts, e.g. "followup/<hash>" or "<hash>/<sequence>"
+		parts := strings.Split(job.Key, "/")
+		for i := range parts {
+			parts[i] = rehash(parts[i], numbers, hasher)
+		}
+		key := strings.Join(parts, "/")
+
+		payload, err := rehashPayload(job.Payload, numbers, hasher)
+		if err != nil {
+			log.Printf("Skipping job %s: %v", job.ID, err)
+			continue
+		}
+		if key == job.Key && payload == nil {
+			unchanged++
+			continue
+		}
+		if payload == nil {
+			payload = job.Payload
+		}
+
+		if dryRun {
+			updated++
+			continue
+		}
+		rewritten, err := store.Rewrite(job.ID, key, payload, now)
+		if err != nil {
+			log.Fatalf("Error rewriting job %s: %v", job.ID, err)
+		}
+		if !rewritten {
+			log.Printf("Skipping job %s: it is running", job.ID)
+			claimed++
+			continue
+		}
+		updated++
+	}
+
+	report(fmt.Sprintf("scheduled jobs: %d to update, %d already current, %d running", updated, unchanged, claimed), dryRun)
+}
+
+// rehashPayload returns the payload with every known hash in it replaced, or
+// nil if it has none to replace
+func rehashPayload(raw json.RawMessage, numbers map[string]string, hasher utils.PhoneHasher) (json.RawMessage, error) {
+	// Numbers are kept as written, as float64 would round nanosecond timestamps
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var payload interface{}
+	if err := decoder.Decode(&payload); err != nil {
+		return nil, fmt.Errorf("error decoding payload: %w", err)
+	}
+
+	changed := false
+	payload = rehashValue(payload, numbers, hasher, &changed)
+	if !changed {
+		return nil, nil
+	}
+	return json.Marshal(payload)
+}
+
+// rehashValue replaces known hashes anywhere in a decoded JSON value. Lists
+// drop repeated strings, as every old hash of a number becomes the same new one.
+func rehashValue(value interface{}, numbers map[string]string, hasher utils.PhoneHasher, changed *bool) interface{} {
+	switch v := value.(type) {
+	case string:
+		newValue := rehash(v, numbers, hasher)
+		if newValue != v {
+			*changed = true
+		}
+		return newValue
+	case []interface{}:
+		seen := make(map[string]bool)
+		items := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			item = rehashValue(item, numbers, hasher, changed)
+			if s, ok := item.(string); ok {
+				if seen[s] {
+					*changed = true
+					continue
+				}
+				seen[s] = true
+			}
+			items = append(items, item)
+		}
+		return items
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = rehashValue(item, numbers, hasher, changed)
+		}
+		return v
+	default:
+		return value
+	}
+}
+
+// report logs a migration summary
+func report(summary string, dryRun bool) {
+	if dryRun {
+		log.Printf("Dry run, %s", summary)
+		return
+	}
+	log.Printf("Migrated %s", summary)
+}
+
+// migrateMessages rewrites the phone hash of tracked messages
+func migrateMessages(store delivery.Store, numbers map[string]string, hasher utils.PhoneHasher, dryRun bool) {
+	messages, err := store.List("")
+	if err != nil {
+		log.Fatalf("Error listing messages: %v", err)
+	}
+
+	updated, unchanged, unmatched := 0, 0, 0
+	for _, msg := range messages {
+		number, ok := numbers[msg.PhoneHash]
+		if !ok {
+			unmatched++
+			continue
+		}
+
+		newHash := hasher.Hash(number)
+		if newHash == msg.PhoneHash {
+			unchanged++
+			continue
+		}
+
+		updated++
+		if dryRun {
+			continue
+		}
+		err := store.Update(msg.ID, func(stored *delivery.Message, exists bool) {
+			stored.PhoneHash = newHash
+		})
+		if err != nil {
+			log.Fatalf("Error updating message %s: %v", msg.ID, err)
+		}
+	}
+
+	report(fmt.Sprintf("messages: %d to update, %d already current, %d unmatched", updated, unchanged, unmatched), dryRun)
+}
+
+// migrate rewrites the hash in field of each record that isn't already on the current key
+func migrate(ctx context.Context, client airtable.Client, table, field string, records []airtable.Record, numbers map[string]string, hasher utils.PhoneHasher, dryRun bool) {
+	var updates []airtable.Record
+	unchanged, unmatched := 0, 0
+
+	for _, record := range records {
+		hash, _ := record.Fields[field].(string)
+
+		number, ok := recordNumber(record)
+		if !ok {
+			number, ok = numbers[hash]
+		}
+		if !ok {
+			log.Printf("Skipping %s record %s: no phone number found for hash %q", table, record.ID, hash)
+			unmatched++
+			continue
+		}
+
+		newHash := hasher.Hash(number)
+		if newHash == hash {
+			unchanged++
+			continue
+		}
+
+		updates = append(updates, airtable.Record{
+			ID:     record.ID,
+			Fields: map[string]interface{}{field: newHash},
+		})
+	}
+
+	summary := fmt.Sprintf("%s: %d to update, %d already current, %d unmatched", table, len(updates), unchanged, unmatched)
+	if dryRun {
+		log.Printf("Dry run, %s", summary)
+		return
+	}
+
+	if err := client.UpdateRecords(ctx, table, updates); err != nil {
+		log.Fatalf("Error updating %s records: %v", table, err)
+	}
+	log.Printf("Migrated %s", summary)
+}
+
+// recordNumber returns the record's phone field in E.164 format
+func recordNumber(record airtable.Record) (string, bool) {
+	raw, _ := record.Fields["phone"].(string)
+	if raw == "" {
+		return "", false
+	}
+
+	number, err := phone.Normalize(raw)
+	if err != nil {
+		return "", false
+	}
+	return number, true
+}
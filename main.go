@@ -1,19 +1,47 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	_ "time/tzdata" // Send windows need time zones even where the OS has no tzdata
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 
 	"sample-golang/pkg/api"
+	"sample-golang/pkg/campaign"
 	"sample-golang/pkg/clients/airtable"
+	"sample-golang/pkg/clients/otp"
 	"sample-golang/pkg/clients/shortio"
 	"sample-golang/pkg/clients/textmagic"
+	"sample-golang/pkg/clients/twilio"
 	"sample-golang/pkg/config"
+	"sample-golang/pkg/consent"
+	"sample-golang/pkg/database"
+	"sample-golang/pkg/delivery"
+	"sample-golang/pkg/docstore"
 	"sample-golang/pkg/middleware"
+	"sample-golang/pkg/models"
+	"sample-golang/pkg/phone"
+	"sample-golang/pkg/queue"
+	"sample-golang/pkg/ratelimit"
+	"sample-golang/pkg/registration"
+	"sample-golang/pkg/resp"
+	"sample-golang/pkg/scheduler"
+	"sample-golang/pkg/sendwindow"
 	"sample-golang/pkg/services"
+	"sample-golang/pkg/templates"
+	"sample-golang/pkg/token"
+	"sample-golang/pkg/utils"
+	"sample-golang/pkg/workflow"
 )
 
 func main() {
@@ -25,18 +53,139 @@ func main() {
 	// Initialize configuration
 	cfg := config.LoadConfig()
 
+	// Numbers without a country code are read as local to this region
+	if err := phone.SetDefaultRegion(cfg.PhoneRegion); err != nil {
+		log.Fatalf("Error configuring phone numbers: %v", err)
+	}
+
 	// Initialize API clients
 	textMagicClient := textmagic.NewClient(cfg.TextMagicUsername, cfg.TextMagicAPIKey)
-	airtableClient := airtable.NewClient(cfg.AirtableAPIKey, cfg.AirtableBaseID)
+	// Airtable requests are paced per instance, so with several instances set
+	// AIRTABLE_REQUESTS_PER_SECOND to each one's share of the base's limit
+	airtableClient := airtable.NewClient(cfg.AirtableAPIKey, cfg.AirtableBaseID, cfg.AirtableRate)
 	shortIOClient := shortio.NewClient(cfg.ShortIOAPIKey, cfg.ShortIODomain)
 
+	// State shared across instances and deploys lives in Postgres, or SQLite
+	// when a single instance runs on a disk that survives restarts
+	var db *sql.DB
+	if cfg.Store == "sql" || cfg.VerificationStore == "sql" {
+		db, err = openDatabase(cfg)
+		if err != nil {
+			log.Fatalf("Error connecting to database: %v", err)
+		}
+	}
+	documents, err := newDocumentBackend(cfg, db)
+	if err != nil {
+		log.Fatalf("Error initializing document store: %v", err)
+	}
+
+	// Initialize the follow-up scheduler
+	jobStore, err := newJobStore(cfg, db, documents)
+	if err != nil {
+		log.Fatalf("Error initializing job store: %v", err)
+	}
+	jobScheduler := scheduler.NewScheduler(jobStore, 10*time.Second)
+
+	// Opt-outs, finished registrations and message delivery are tracked in shared documents
+	consentStore := consent.NewStore(documents)
+	registrationStore := registration.NewStore(documents)
+	deliveryStore := delivery.NewStore(documents)
+
+	// Phone hashes appear in public URLs, so they're keyed to stop brute-force reversal
+	phoneHasher, err := utils.NewPhoneHasher(cfg.PhoneHashKeys, cfg.PhoneHashLegacy)
+	if err != nil {
+		log.Fatalf("Error initializing phone hasher, set PHONE_HASH_KEYS: %v", err)
+	}
+
+	// Form links carry signed tokens instead of editable query params. The
+	// unsigned "id" is only added with LINK_LEGACY_ID=true, for forms not yet
+	// reading the token.
+	tokens, err := token.NewService(cfg.TokenSecrets, time.Duration(cfg.TokenTTL)*time.Hour, cfg.TokenLegacyID)
+	if err != nil {
+		log.Fatalf("Error initializing token service, set LINK_TOKEN_SECRETS: %v", err)
+	}
+
+	// Each town's forms, tables and reminders are defined by its campaign
+	campaigns, err := newCampaignRegistry(cfg)
+	if err != nil {
+		log.Fatalf("Error loading campaigns: %v", err)
+	}
+
+	// Message templates are shared, with per-campaign overrides
+	messageTemplates, err := newTemplateLibrary(cfg, campaigns)
+	if err != nil {
+		log.Fatalf("Error loading message templates: %v", err)
+	}
+
+	// Reminders wait for daytime in the recipient's time zone
+	sendWindow, err := newSendWindowPolicy(cfg, campaigns)
+	if err != nil {
+		log.Fatalf("Error configuring send windows: %v", err)
+	}
+
+	// Reminder sequences run per contact on top of the scheduler
+	workflows, err := newWorkflowEngine(cfg, campaigns, messageTemplates, sendWindow, jobScheduler, documents)
+	if err != nil {
+		log.Fatalf("Error loading reminder sequences: %v", err)
+	}
+
 	// Initialize services
+	deliveryService := services.NewDeliveryService(deliveryStore, phoneHasher)
+	registrationService := services.NewRegistrationService(registrationStore, workflows, jobScheduler, airtableClient, campaigns, cfg.FilloutWriteR2E, cfg.AirtableR2EHashField)
+
+	// New R2E records arrive by Airtable webhook instead of polling
+	r2eWatch := services.NewR2EWatchService(airtableClient, services.NewR2EWebhookStore(documents), registrationService, campaigns, cfg.AirtableWebhookURL, cfg.AirtableR2EHashField)
+
 	submissionService := services.NewLandingSubmissionService(
 		textMagicClient,
 		airtableClient,
 		shortIOClient,
-		cfg,
+		jobScheduler,
+		consentStore,
+		registrationStore,
+		deliveryService,
+		phoneHasher,
+		tokens,
+		campaigns,
+		workflows,
+		messageTemplates,
+		sendWindow,
+		r2eWatch,
+		cfg.AirtableR2EHashField,
 	)
+	inboundService := services.NewInboundMessageService(textMagicClient, consentStore, deliveryService, phoneHasher)
+
+	// Pending verifications survive restarts and are shared across instances
+	verificationStore, err := newVerificationStore(cfg, db)
+	if err != nil {
+		log.Fatalf("Error initializing verification store: %v", err)
+	}
+	verifyClient, err := newVerifyClient(cfg, textMagicClient, verificationStore)
+	if err != nil {
+		log.Fatalf("Error configuring verification codes, check OTP_CODE_LENGTH: %v", err)
+	}
+	verificationService := services.NewVerificationService(verifyClient, verificationStore, services.JSONCodec[models.LandingFormData](), phoneHasher, services.VerificationLimits{
+		MaxAttempts:     cfg.VerifyMaxAttempts,
+		MaxSends:        cfg.VerifyMaxSends,
+		ResendCooldown:  time.Duration(cfg.VerifyResendCooldown) * time.Second,
+		LockoutDuration: time.Duration(cfg.VerifyLockout) * time.Second,
+	})
+	sweepCtx, stopSweeper := context.WithCancel(context.Background())
+	verificationService.StartSweeper(sweepCtx, time.Minute)
+	r2eWatch.Start(sweepCtx)
+
+	// Bound how many submissions are processed concurrently
+	submissionQueue := queue.NewQueue(
+		cfg.SubmissionWorkers,
+		cfg.SubmissionQueueSize,
+		submissionService.ProcessLandingSubmission,
+	)
+	submissionQueue.Start(context.Background())
+
+	// Start the scheduler after handlers are registered so reloaded jobs can run
+	if err := jobScheduler.Start(context.Background()); err != nil {
+		log.Fatalf("Error starting scheduler: %v", err)
+	}
 
 	// Set Gin to release mode in production
 	gin.SetMode(gin.DebugMode)
@@ -44,14 +193,97 @@ func main() {
 	// Create a new Gin router with default middleware
 	router := gin.Default()
 
+	// Only take the client IP from headers set by a proxy we trust, so rate
+	// limits can't be dodged with a forged X-Forwarded-For
+	router.TrustedPlatform = cfg.ClientIPHeader
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatalf("Error configuring trusted proxies: %v", err)
+	}
+
 	// Add CORS middleware
 	router.Use(middleware.CORS())
 
 	// Initialize handlers
-	handlers := api.NewHandlers(submissionService)
+	handlers := api.NewHandlers(
+		submissionQueue,
+		inboundService,
+		deliveryService,
+		registrationService,
+		r2eWatch,
+		verificationService,
+		phoneHasher,
+		tokens,
+		campaigns,
+		workflows,
+		messageTemplates,
+		cfg.RequireVerification,
+		cfg.QueueRetryAfter,
+	)
+
+	// Register routes. Signed webhooks are accepted once across every instance.
+	replays, err := newReplayStore(cfg, db)
+	if err != nil {
+		log.Fatalf("Error initializing webhook replay store: %v", err)
+	}
+	landingAuth := middleware.WebhookAuth(middleware.WebhookAuthConfig{
+		Secrets:      cfg.LandingSecrets,
+		Tokens:       cfg.LandingTokens,
+		ReplayWindow: time.Duration(cfg.WebhookReplayWindow) * time.Second,
+		Replays:      replays,
+		Disabled:     cfg.WebhookAuthDisabled,
+	})
+	rateLimits := newRateLimitBackend(cfg)
+	phoneKey := func(raw string) string {
+		return services.ConsentKey(phoneHasher, raw)
+	}
+	// Limit by IP before authenticating, and by phone only for authenticated
+	// requests. Framer posts server-to-server, so its IPs carry every genuine
+	// submission and the IP limit is sized for its peak rather than one visitor.
+	landingIPLimit := ratelimit.Middleware(rateLimits, "landing",
+		ratelimit.Rule{Name: "ip", Limit: mustParseLimit(cfg.LandingIPLimit), Key: ratelimit.ByIP()},
+	)
+	landingPhoneLimit := ratelimit.Middleware(rateLimits, "landing",
+		ratelimit.Rule{Name: "phone", Limit: mustParseLimit(cfg.LandingPhoneLimit), Key: ratelimit.ByJSONField("phone", phoneKey)},
+	)
+	router.POST("/api/submissions/landing", landingIPLimit, landingAuth, landingPhoneLimit, handlers.HandleLandingSubmission)
+	router.POST("/api/submissions/landing/:campaign", landingIPLimit, landingAuth, landingPhoneLimit, handlers.HandleLandingSubmission)
+	verifyLimit := ratelimit.Middleware(rateLimits, "verification",
+		ratelimit.Rule{Name: "ip", Limit: mustParseLimit(cfg.VerifyIPLimit), Key: ratelimit.ByIP()},
+		ratelimit.Rule{Name: "phone", Limit: mustParseLimit(cfg.VerifyPhoneLimit), Key: ratelimit.ByJSONField("phone", phoneKey)},
+	)
+	router.POST("/api/verification/start", verifyLimit, handlers.StartVerification)
+	router.POST("/api/verification/check", verifyLimit, handlers.CheckVerification)
 
-	// Register routes
-	router.POST("/api/submissions/landing", handlers.HandleLandingSubmission)
+	// TextMagic can't sign callbacks, so their URLs carry a token
+	textMagicAuth := middleware.WebhookAuth(middleware.WebhookAuthConfig{
+		Tokens:     cfg.TextMagicTokens,
+		TokenParam: "token",
+		Disabled:   cfg.WebhookAuthDisabled,
+	})
+	router.POST("/api/webhooks/textmagic/inbound", textMagicAuth, handlers.HandleTextMagicInbound)
+	router.POST("/api/webhooks/textmagic/delivery", textMagicAuth, handlers.HandleTextMagicDelivery)
+	filloutAuth := middleware.WebhookAuth(middleware.WebhookAuthConfig{
+		Secrets:      cfg.FilloutSecrets,
+		Tokens:       cfg.FilloutTokens,
+		ReplayWindow: time.Duration(cfg.WebhookReplayWindow) * time.Second,
+		Replays:      replays,
+		Disabled:     cfg.WebhookAuthDisabled,
+	})
+	router.POST("/api/webhooks/fillout", filloutAuth, handlers.HandleFilloutSubmission)
+	router.POST("/api/webhooks/airtable", handlers.HandleAirtableWebhook)
+	router.GET("/api/tokens/verify", handlers.VerifyToken)
+
+	// Operational endpoints expose message history and contacts' workflows
+	adminAuth := middleware.WebhookAuth(middleware.WebhookAuthConfig{
+		Tokens: cfg.AdminAPIKeys,
+	})
+	admin := router.Group("/api", adminAuth)
+	admin.GET("/messages", handlers.ListMessages)
+	admin.GET("/messages/:id", handlers.GetMessage)
+	admin.GET("/queue/stats", handlers.QueueStats)
+	admin.GET("/workflows/:contact", handlers.GetWorkflows)
+	admin.DELETE("/workflows/:contact", handlers.CancelWorkflows)
+	admin.POST("/templates/preview", handlers.PreviewTemplate)
 	router.GET("/health", handlers.HealthCheck)
 
 	// Get port from environment or default to 8080
@@ -60,9 +292,267 @@ func main() {
 		port = "8080"
 	}
 
+	server := &http.Server{
+		Addr:    ":" + port,
+		Handler: router,
+	}
+
 	// Start the server
-	log.Printf("Server starting on port %s", port)
-	if err := router.Run(":" + port); err != nil {
-		log.Fatalf("Error starting server: %v", err)
+	go func() {
+		log.Printf("Server starting on port %s", port)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Error starting server: %v", err)
+		}
+	}()
+
+	// Wait for App Platform to ask us to stop
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-stop
+
+	log.Printf("Received %s, shutting down with a %ds drain timeout", sig, cfg.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownTimeout)*time.Second)
+	defer cancel()
+
+	// Stop accepting requests first so nothing new is queued
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Error shutting down server: %v", err)
+	}
+
+	// Drain queued submissions, persisting any that don't finish in time
+	for _, data := range submissionQueue.Stop(shutdownCtx) {
+		if _, err := jobScheduler.Schedule(services.SubmissionJobKind, time.Now(), data); err != nil {
+			log.Printf("Error persisting unprocessed submission: %v", err)
+		}
+	}
+
+	jobScheduler.Stop(shutdownCtx)
+	stopSweeper()
+	log.Println("Shutdown complete")
+}
+
+// openDatabase connects to the shared database. App Platform's disks are wiped
+// on every deploy and aren't shared between containers, so deployments use
+// Postgres; a "sqlite:" DATABASE_URL is for a single long-lived instance.
+func openDatabase(cfg *config.Config) (*sql.DB, error) {
+	if cfg.DatabaseURL == "" {
+		return nil, errors.New("DATABASE_URL is not set; for local development set STORE=file or DATABASE_URL=sqlite:data/app.db")
+	}
+	return database.Open(cfg.DatabaseURL)
+}
+
+// newDocumentBackend builds the document backend selected by configuration. The
+// file backend is for local development; deployed state must be in the database.
+func newDocumentBackend(cfg *config.Config, db *sql.DB) (docstore.Backend, error) {
+	switch cfg.Store {
+	case "sql":
+		return docstore.NewSQLBackend(db)
+	case "file":
+		return docstore.NewFileBackend(cfg.DataDir)
+	default:
+		return nil, fmt.Errorf("unknown STORE %q", cfg.Store)
+	}
+}
+
+// newJobStore builds the scheduler store to match the document backend
+func newJobStore(cfg *config.Config, db *sql.DB, documents docstore.Backend) (scheduler.Store, error) {
+	if cfg.Store == "sql" {
+		return scheduler.NewSQLStore(db)
+	}
+	return scheduler.NewDocStore(documents), nil
+}
+
+// newCampaignRegistry loads campaigns from the configured file. Without one, only
+// the original Burlington campaign runs, using the Airtable tables from the environment.
+func newCampaignRegistry(cfg *config.Config) (campaign.Registry, error) {
+	defaults := campaign.Campaign{
+		PartialTable:    cfg.AirtablePartialTable,
+		R2ETable:        cfg.AirtableR2ETable,
+		TextMagicList:   "4344890", // Customers List ID
+		ReminderDelay:   utils.Duration(15 * time.Minute),
+		ReminderMessage: "Hello {{.First}}! Finish signing up for DemocracyOS here: {{.Link}}",
+	}
+
+	if cfg.CampaignsFile != "" {
+		return campaign.LoadFile(cfg.CampaignsFile, defaults)
+	}
+
+	burlington := defaults
+	burlington.Slug = "burlington"
+	burlington.Name = "Burlington, VT"
+	burlington.FormURL = "https://forms.democracyos.com/burlingtonvt-register"
+	burlington.ReminderFormURL = "https://forms.democracyOS.com/t/bj1RaePxL2us"
+	return campaign.NewRegistry([]campaign.Campaign{burlington}, burlington.Slug)
+}
+
+// newTemplateLibrary loads shared templates from the configured file and each campaign's own
+func newTemplateLibrary(cfg *config.Config, campaigns campaign.Registry) (templates.Library, error) {
+	var shared map[string]string
+	if cfg.TemplatesFile != "" {
+		loaded, err := templates.LoadFile(cfg.TemplatesFile)
+		if err != nil {
+			return nil, err
+		}
+		shared = loaded
+	}
+
+	overrides := make(map[string]map[string]string)
+	for _, c := range campaigns.List() {
+		overrides[c.Slug] = c.Templates
+	}
+	return templates.NewLibrary(shared, overrides, cfg.SMSMaxSegments)
+}
+
+// newWorkflowEngine loads reminder sequences from the configured file. Campaigns
+// that don't name a sequence get one reminder after their reminder delay.
+func newWorkflowEngine(cfg *config.Config, campaigns campaign.Registry, library templates.Library, window sendwindow.Policy, sched scheduler.Scheduler, documents docstore.Backend) (workflow.Engine, error) {
+	var sequences []workflow.Sequence
+	if cfg.SequencesFile != "" {
+		loaded, err := workflow.LoadFile(cfg.SequencesFile)
+		if err != nil {
+			return nil, err
+		}
+		sequences = loaded
+	}
+
+	defined := make(map[string]bool)
+	for _, seq := range sequences {
+		defined[seq.Name] = true
+	}
+
+	for _, c := range campaigns.List() {
+		if c.Sequence == "" {
+			sequences = append(sequences, workflow.Sequence{
+				Name: c.SequenceName(),
+				Steps: []workflow.Step{{
+					Name:      "reminder",
+					Delay:     c.ReminderDelay,
+					Condition: workflow.ConditionNotRegistered,
+					Template:  c.ReminderMessage,
+				}},
+			})
+		} else if !defined[c.Sequence] {
+			return nil, fmt.Errorf("campaign %s uses undefined sequence %q", c.Slug, c.Sequence)
+		}
+	}
+
+	if err := checkTemplates(campaigns, sequences, library); err != nil {
+		return nil, err
+	}
+
+	return workflow.NewEngine(sequences, workflow.NewStore(documents), sched, window)
+}
+
+// newSendWindowPolicy uses the configured sending hours unless a campaign sets its own
+func newSendWindowPolicy(cfg *config.Config, campaigns campaign.Registry) (sendwindow.Policy, error) {
+	start, err := sendwindow.ParseClock(cfg.SendWindowStart)
+	if err != nil {
+		return nil, err
+	}
+	end, err := sendwindow.ParseClock(cfg.SendWindowEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	overrides := make(map[string]sendwindow.Window)
+	for _, c := range campaigns.List() {
+		if c.SendWindow != nil {
+			overrides[c.Slug] = *c.SendWindow
+		}
+	}
+	return sendwindow.NewPolicy(sendwindow.Window{Start: start, End: end, Timezone: cfg.SendWindowTimezone}, overrides)
+}
+
+// checkTemplates renders every campaign's reminder templates with sample data so
+// mistakes stop the app at startup instead of when a reminder is due
+func checkTemplates(campaigns campaign.Registry, sequences []workflow.Sequence, library templates.Library) error {
+	steps := make(map[string][]workflow.Step)
+	for _, seq := range sequences {
+		steps[seq.Name] = seq.Steps
+	}
+
+	for _, c := range campaigns.List() {
+		sample := templates.Sample(c.Name, c.Slug)
+		texts := []string{c.ReminderMessage}
+		for _, step := range steps[c.SequenceName()] {
+			texts = append(texts, step.Template)
+		}
+
+		for _, text := range texts {
+			msg, err := library.Render(c.Slug, text, sample)
+			if err != nil {
+				return fmt.Errorf("campaign %s: %w", c.Slug, err)
+			}
+			for _, warning := range msg.Warnings {
+				log.Printf("Warning: campaign %s template %q: %s", c.Slug, text, warning)
+			}
+		}
+	}
+	return nil
+}
+
+// newVerifyClient picks Twilio Verify or the self-hosted OTP provider, which
+// sends codes over TextMagic and keeps them in the verification store
+func newVerifyClient(cfg *config.Config, sender otp.Sender, codes otp.CodeStore) (twilio.Client, error) {
+	if cfg.VerifyProvider == "local" {
+		return otp.NewClient(sender, codes, cfg.OTPCodeLength, time.Duration(cfg.OTPTTL)*time.Second)
+	}
+	return twilio.NewClient(cfg.TwilioAccountSID, cfg.TwilioAuthToken, cfg.TwilioVerifyService), nil
+}
+
+// newVerificationStore builds the pending verification store selected by configuration
+func newVerificationStore(cfg *config.Config, db *sql.DB) (services.VerificationStore, error) {
+	switch cfg.VerificationStore {
+	case "sql":
+		return services.NewSQLVerificationStore(db)
+	case "redis":
+		if cfg.RedisAddr == "" {
+			return nil, errors.New("VERIFICATION_STORE=redis requires REDIS_ADDR")
+		}
+		client, err := resp.NewClient(cfg.RedisAddr, cfg.RedisPassword, 10)
+		if err != nil {
+			return nil, err
+		}
+		return services.NewRedisVerificationStore(client, "verification:"), nil
+	default:
+		return services.NewMemoryVerificationStore(), nil
+	}
+}
+
+// newReplayStore keeps webhook signatures in Redis when configured, otherwise
+// in the SQL database if one is open, falling back to process memory
+func newReplayStore(cfg *config.Config, db *sql.DB) (middleware.ReplayStore, error) {
+	switch {
+	case cfg.RedisAddr != "":
+		client, err := resp.NewClient(cfg.RedisAddr, cfg.RedisPassword, 10)
+		if err != nil {
+			return nil, err
+		}
+		return middleware.NewRedisReplayStore(client, "webhook:"), nil
+	case db != nil:
+		return middleware.NewSQLReplayStore(db)
+	default:
+		return middleware.NewMemoryReplayStore(), nil
+	}
+}
+
+// newRateLimitBackend shares rate limit counters through Redis when configured
+func newRateLimitBackend(cfg *config.Config) ratelimit.Backend {
+	if cfg.RedisAddr == "" {
+		return ratelimit.NewMemoryBackend()
+	}
+	client, err := resp.NewClient(cfg.RedisAddr, cfg.RedisPassword, 10)
+	if err != nil {
+		log.Fatalf("Error configuring Redis: %v", err)
+	}
+	return ratelimit.NewRedisBackend(client, "ratelimit:")
+}
+
+// mustParseLimit parses a rate limit from configuration or exits
+func mustParseLimit(value string) ratelimit.Limit {
+	limit, err := ratelimit.ParseLimit(value)
+	if err != nil {
+		log.Fatalf("Error parsing rate limit: %v", err)
 	}
+	return limit
 }
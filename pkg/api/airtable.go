@@ -0,0 +1,46 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"sample-golang/pkg/clients/airtable"
+	"sample-golang/pkg/services"
+)
+
+// HandleAirtableWebhook receives Airtable's notice that an R2E table changed.
+// The body is signed with the webhook's MAC secret and carries no changes
+// itself; those are fetched afterwards.
+func (h *Handlers) HandleAirtableWebhook(c *gin.Context) {
+	// The MAC covers the exact bytes Airtable sent
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error reading body"})
+		return
+	}
+
+	err = h.r2eWatch.HandleNotification(c.Request.Context(), body, c.GetHeader(airtable.MACHeader))
+	switch {
+	case errors.Is(err, services.ErrInvalidSignature):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid signature"})
+		return
+	case errors.Is(err, services.ErrUnknownWebhook):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown webhook"})
+		return
+	case errors.Is(err, services.ErrInvalidNotification):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid notification"})
+		return
+	case err != nil:
+		log.Printf("Error handling Airtable notification: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error handling notification"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+	})
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"sample-golang/pkg/campaign"
+	"sample-golang/pkg/models"
+	"sample-golang/pkg/services"
+	"sample-golang/pkg/token"
+)
+
+// HandleFilloutSubmission marks the registrant who submitted a Fillout form as
+// complete. The form identifies them with the hidden "token" field from their
+// link, which also names the campaign; the "id" and other URL fields are
+// unsigned, so they aren't trusted on their own. Links issued before tokens
+// carried a campaign count towards the default campaign.
+func (h *Handlers) HandleFilloutSubmission(c *gin.Context) {
+	var submission models.FilloutSubmission
+	if err := c.ShouldBindJSON(&submission); err != nil {
+		log.Printf("Error parsing Fillout submission: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format"})
+		return
+	}
+
+	reference := submission.Submission.SubmissionID
+	raw := submission.URLParameter("token")
+	if raw == "" {
+		log.Printf("Ignoring Fillout submission %s without a token", reference)
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Submission has no token"})
+		return
+	}
+
+	// Finishing the form counts even if the link expired while it was open
+	claims, err := h.tokens.Verify(raw)
+	if err != nil && !errors.Is(err, token.ErrTokenExpired) {
+		log.Printf("Rejecting Fillout submission %s: %v", reference, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid token"})
+		return
+	}
+	if claims.PhoneHash == "" {
+		log.Printf("Ignoring Fillout submission %s with a token that names no registrant", reference)
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Token has no registrant"})
+		return
+	}
+
+	completion := services.Completion{
+		PhoneHash: claims.PhoneHash,
+		Campaign:  claims.Campaign,
+		First:     claims.First,
+		Last:      claims.Last,
+		Source:    "fillout",
+		Reference: reference,
+	}
+
+	err = h.registrationService.MarkComplete(c.Request.Context(), completion)
+	switch {
+	case errors.Is(err, campaign.ErrUnknownCampaign):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown campaign"})
+		return
+	case err != nil:
+		log.Printf("Error processing Fillout submission %s: %v", completion.Reference, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error processing submission"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+	})
+}
@@ -2,28 +2,74 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"net/url"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 
+	"sample-golang/pkg/campaign"
+	"sample-golang/pkg/delivery"
 	"sample-golang/pkg/models"
+	"sample-golang/pkg/phone"
+	"sample-golang/pkg/queue"
 	"sample-golang/pkg/services"
+	"sample-golang/pkg/templates"
+	"sample-golang/pkg/token"
 	"sample-golang/pkg/utils"
+	"sample-golang/pkg/workflow"
 )
 
 // Handlers contains all HTTP handlers for the API
 type Handlers struct {
-	submissionService services.LandingSubmissionService
+	submissionQueue     queue.Queue
+	inboundService      services.InboundMessageService
+	deliveryService     services.DeliveryService
+	registrationService services.RegistrationService
+	r2eWatch            services.R2EWatchService
+	verification        *services.VerificationService[models.LandingFormData]
+	phoneHasher         utils.PhoneHasher
+	tokens              token.Service
+	campaigns           campaign.Registry
+	workflows           workflow.Engine
+	templates           templates.Library
+	requireVerify       bool
+	retryAfter          int
 }
 
 // NewHandlers creates a new Handlers instance
-func NewHandlers(submissionService services.LandingSubmissionService) *Handlers {
+func NewHandlers(
+	submissionQueue queue.Queue,
+	inboundService services.InboundMessageService,
+	deliveryService services.DeliveryService,
+	registrationService services.RegistrationService,
+	r2eWatch services.R2EWatchService,
+	verification *services.VerificationService[models.LandingFormData],
+	phoneHasher utils.PhoneHasher,
+	tokens token.Service,
+	campaigns campaign.Registry,
+	workflows workflow.Engine,
+	templates templates.Library,
+	requireVerify bool,
+	retryAfter int,
+) *Handlers {
 	return &Handlers{
-		submissionService: submissionService,
+		submissionQueue:     submissionQueue,
+		inboundService:      inboundService,
+		deliveryService:     deliveryService,
+		registrationService: registrationService,
+		r2eWatch:            r2eWatch,
+		verification:        verification,
+		phoneHasher:         phoneHasher,
+		tokens:              tokens,
+		campaigns:           campaigns,
+		workflows:           workflows,
+		templates:           templates,
+		requireVerify:       requireVerify,
+		retryAfter:          retryAfter,
 	}
 }
 
@@ -34,6 +80,11 @@ func (h *Handlers) HealthCheck(c *gin.Context) {
 	})
 }
 
+// QueueStats reports the submission queue depth and worker usage
+func (h *Handlers) QueueStats(c *gin.Context) {
+	c.JSON(http.StatusOK, h.submissionQueue.Stats())
+}
+
 // Processes incoming webhook requests from Framer
 func (h *Handlers) HandleLandingSubmission(c *gin.Context) {
 	var landingData models.LandingFormData
@@ -62,23 +113,80 @@ func (h *Handlers) HandleLandingSubmission(c *gin.Context) {
 		return
 	}
 
-	// Process the form data in background
-	go h.submissionService.ProcessLandingSubmission(landingData)
+	// Normalize the phone so IDs and lookups agree however it was typed
+	number, err := phone.Normalize(landingData.Phone)
+	if err != nil {
+		log.Printf("Rejecting submission: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid phone number"})
+		return
+	}
+	landingData.Phone = number
+
+	if !h.resolveCampaign(c, &landingData) {
+		return
+	}
+
+	// Hold the submission until the phone number is confirmed
+	if h.requireVerify {
+		h.startVerification(c, services.VerificationRequest{Phone: landingData.Phone}, landingData)
+		return
+	}
+
+	h.acceptSubmission(c, landingData)
+}
+
+// resolveCampaign sets the submission's campaign from the path, falling back to
+// the payload and then the default campaign. It responds 404 for unknown slugs.
+func (h *Handlers) resolveCampaign(c *gin.Context, landingData *models.LandingFormData) bool {
+	if slug := c.Param("campaign"); slug != "" {
+		landingData.Campaign = slug
+	}
+
+	camp, err := h.campaigns.Get(landingData.Campaign)
+	if err != nil {
+		log.Printf("Rejecting submission: %v", err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown campaign"})
+		return false
+	}
+
+	landingData.Campaign = camp.Slug
+	return true
+}
 
-	// Define the Fillout form URL
-	filloutFormURL := "https://forms.democracyos.com/burlingtonvt-register"
+// acceptSubmission queues the form data and responds with the campaign's Fillout redirect
+func (h *Handlers) acceptSubmission(c *gin.Context, landingData models.LandingFormData) {
+	camp, err := h.campaigns.Get(landingData.Campaign)
+	if err != nil {
+		log.Printf("Rejecting submission: %v", err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown campaign"})
+		return
+	}
 
-	// Hash the phone number for security
-	hashedPhone := utils.HashString(landingData.Phone)
+	// Sign the registrant's details so the form link can't be edited to impersonate someone
+	params, err := h.tokens.LinkParams(token.Claims{
+		First:     landingData.First,
+		Last:      landingData.Last,
+		PhoneHash: h.phoneHasher.Hash(landingData.Phone),
+		Campaign:  camp.Slug,
+	})
+	if err != nil {
+		log.Printf("Error issuing redirect token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error processing submission"})
+		return
+	}
 
-	// Build query parameters
-	params := url.Values{}
-	params.Add("first", landingData.First)
-	params.Add("last", landingData.Last)
-	params.Add("id", hashedPhone) // Use hashed phone as id
+	// Queue the form data for background processing
+	if err := h.submissionQueue.Enqueue(landingData); err != nil {
+		if errors.Is(err, queue.ErrQueueFull) {
+			log.Printf("Rejecting submission, queue is full: %+v", h.submissionQueue.Stats())
+		}
+		c.Header("Retry-After", strconv.Itoa(h.retryAfter))
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Server is busy, please try again shortly"})
+		return
+	}
 
 	// Create the redirect URL with parameters
-	redirectURL := fmt.Sprintf("%s?%s", filloutFormURL, params.Encode())
+	redirectURL := fmt.Sprintf("%s?%s", camp.FormURL, params.Encode())
 
 	// Return redirect response
 	c.JSON(http.StatusOK, gin.H{
@@ -87,3 +195,90 @@ func (h *Handlers) HandleLandingSubmission(c *gin.Context) {
 	})
 	log.Printf("Redirecting %s to: %s", landingData.Phone, redirectURL)
 }
+
+// HandleTextMagicInbound processes replies forwarded by TextMagic's inbound message callback
+func (h *Handlers) HandleTextMagicInbound(c *gin.Context) {
+	var msg models.InboundMessage
+
+	// TextMagic posts callbacks as form data, but accept JSON as well
+	if err := c.ShouldBind(&msg); err != nil {
+		log.Printf("Error parsing inbound message: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid inbound message"})
+		return
+	}
+
+	if msg.Sender == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing sender"})
+		return
+	}
+
+	keyword, err := h.inboundService.HandleInboundMessage(c.Request.Context(), msg)
+	if err != nil {
+		log.Printf("Error handling inbound message %s: %v", msg.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error handling message"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"keyword": keyword,
+	})
+}
+
+// HandleTextMagicDelivery records delivery receipts from TextMagic's message status callback
+func (h *Handlers) HandleTextMagicDelivery(c *gin.Context) {
+	var receipt models.DeliveryReceipt
+
+	if err := c.ShouldBind(&receipt); err != nil {
+		log.Printf("Error parsing delivery receipt: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid delivery receipt"})
+		return
+	}
+
+	if receipt.ID == "" || receipt.Status == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing message ID or status"})
+		return
+	}
+
+	msg, err := h.deliveryService.HandleDeliveryReceipt(receipt)
+	if err != nil {
+		log.Printf("Error handling delivery receipt for %s: %v", receipt.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error recording receipt"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":         "success",
+		"message_status": msg.Status,
+	})
+}
+
+// GetMessage returns the delivery history of a single message
+func (h *Handlers) GetMessage(c *gin.Context) {
+	msg, err := h.deliveryService.GetMessage(c.Param("id"))
+	if errors.Is(err, delivery.ErrMessageNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading message %s: %v", c.Param("id"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading message"})
+		return
+	}
+
+	c.JSON(http.StatusOK, msg)
+}
+
+// ListMessages returns tracked messages, optionally filtered with ?status=
+func (h *Handlers) ListMessages(c *gin.Context) {
+	messages, err := h.deliveryService.ListMessages(delivery.Status(c.Query("status")))
+	if err != nil {
+		log.Printf("Error listing messages: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing messages"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"messages": messages,
+	})
+}
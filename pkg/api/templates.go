@@ -0,0 +1,59 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"sample-golang/pkg/models"
+	"sample-golang/pkg/templates"
+)
+
+// PreviewTemplate renders a named template or raw template text with sample
+// data, reporting its encoding, segment count and any length warnings
+func (h *Handlers) PreviewTemplate(c *gin.Context) {
+	var req models.TemplatePreviewData
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format"})
+		return
+	}
+	if (req.Template == "") == (req.Text == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provide either template or text"})
+		return
+	}
+
+	camp, err := h.campaigns.Get(req.Campaign)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown campaign"})
+		return
+	}
+
+	data := templates.Sample(camp.Name, camp.Slug)
+	if req.First != "" {
+		data.First = req.First
+	}
+	if req.Last != "" {
+		data.Last = req.Last
+	}
+	if req.Link != "" {
+		data.Link = req.Link
+	}
+
+	var msg templates.Message
+	if req.Template != "" {
+		msg, err = h.templates.RenderNamed(camp.Slug, req.Template, data)
+	} else {
+		msg, err = h.templates.Render(camp.Slug, req.Text, data)
+	}
+	switch {
+	case errors.Is(err, templates.ErrUnknownTemplate):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown template"})
+		return
+	case err != nil:
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, msg)
+}
@@ -0,0 +1,31 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"sample-golang/pkg/token"
+)
+
+// VerifyToken returns the registrant details signed into a form link's token
+func (h *Handlers) VerifyToken(c *gin.Context) {
+	claims, err := h.tokens.Verify(c.Query("token"))
+	switch {
+	case errors.Is(err, token.ErrTokenExpired):
+		c.JSON(http.StatusGone, gin.H{"error": "Link has expired"})
+		return
+	case err != nil:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"first":      claims.First,
+		"last":       claims.Last,
+		"id":         claims.PhoneHash,
+		"campaign":   claims.Campaign,
+		"expires_at": claims.ExpiresAt,
+	})
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"sample-golang/pkg/clients/twilio"
+	"sample-golang/pkg/models"
+	"sample-golang/pkg/phone"
+	"sample-golang/pkg/services"
+)
+
+// StartVerification sends a verification code and holds the landing data until it's confirmed
+func (h *Handlers) StartVerification(c *gin.Context) {
+	var start models.VerificationStartData
+
+	if err := c.ShouldBindJSON(&start); err != nil {
+		log.Printf("Error parsing verification request: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing required fields"})
+		return
+	}
+
+	number, err := phone.Normalize(start.Phone)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid phone number"})
+		return
+	}
+	start.Phone = number
+
+	if !h.resolveCampaign(c, &start.LandingFormData) {
+		return
+	}
+
+	req := services.VerificationRequest{
+		Phone: number,
+	}
+	for _, name := range start.Channels {
+		channel, err := twilio.ParseChannel(name)
+		if err != nil || !channel.ReachesPhone() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported verification channel: " + name})
+			return
+		}
+		req.Channels = append(req.Channels, channel)
+	}
+
+	h.startVerification(c, req, start.LandingFormData)
+}
+
+// CheckVerification confirms a code and releases the held submission for processing
+func (h *Handlers) CheckVerification(c *gin.Context) {
+	var check models.VerificationCheckData
+
+	if err := c.ShouldBindJSON(&check); err != nil {
+		log.Printf("Error parsing verification check: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing required fields"})
+		return
+	}
+
+	number, err := phone.Normalize(check.Phone)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid phone number"})
+		return
+	}
+
+	result, err := h.verification.VerifyCode(c.Request.Context(), number, check.Code)
+	var verifyErr *services.VerificationError
+	switch {
+	case errors.Is(err, services.ErrInvalidCode) && errors.As(err, &verifyErr):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":              "Invalid verification code",
+			"remaining_attempts": verifyErr.RemainingAttempts,
+		})
+		return
+	case errors.As(err, &verifyErr):
+		verificationLimited(c, verifyErr)
+		return
+	case errors.Is(err, services.ErrVerificationExpired):
+		c.JSON(http.StatusGone, gin.H{"error": "Verification expired, please request a new code"})
+		return
+	case err != nil:
+		log.Printf("Error checking verification code: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Error checking verification code"})
+		return
+	}
+
+	log.Printf("Verified %s by %s", services.ConsentKey(h.phoneHasher, number), result.Channel)
+
+	landingData := result.Data
+	if landingData.Phone == "" {
+		// Verification was started without a held submission, nothing more to do
+		c.JSON(http.StatusOK, gin.H{"status": "verified", "channel": result.Channel})
+		return
+	}
+
+	h.acceptSubmission(c, landingData)
+}
+
+// startVerification sends a code as requested and stores the landing data with it
+func (h *Handlers) startVerification(c *gin.Context, req services.VerificationRequest, landingData models.LandingFormData) {
+	channel, err := h.verification.InitiateVerification(c.Request.Context(), req, landingData)
+	var verifyErr *services.VerificationError
+	if errors.As(err, &verifyErr) {
+		verificationLimited(c, verifyErr)
+		return
+	}
+	if errors.Is(err, twilio.ErrInvalidDestination) {
+		log.Printf("Rejecting verification request: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid phone number for the requested channels"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error starting verification: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Error sending verification code"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "verification_required",
+		"channel": channel,
+	})
+}
+
+// verificationLimited rejects a request blocked by a resend cooldown or lockout
+func verificationLimited(c *gin.Context, err *services.VerificationError) {
+	message := "Too many verification attempts, please try again later"
+	if errors.Is(err, services.ErrResendCooldown) {
+		message = "A verification code was sent recently, please wait before requesting another"
+	}
+
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(err.RetryAfter.Seconds()))))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": message})
+}
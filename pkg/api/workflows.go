@@ -0,0 +1,43 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"sample-golang/pkg/workflow"
+)
+
+// GetWorkflows returns a contact's progress through their reminder sequences
+func (h *Handlers) GetWorkflows(c *gin.Context) {
+	progress, err := h.workflows.Progress(c.Param("contact"))
+	if err != nil {
+		log.Printf("Error loading sequence progress: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading sequence progress"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"sequences": progress,
+	})
+}
+
+// CancelWorkflows stops a contact's active sequences, or only the one named by ?sequence=
+func (h *Handlers) CancelWorkflows(c *gin.Context) {
+	err := h.workflows.Cancel(c.Param("contact"), c.Query("sequence"))
+	if errors.Is(err, workflow.ErrProgressNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No active sequence found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error cancelling sequence: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error cancelling sequence"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "cancelled",
+	})
+}
@@ -0,0 +1,162 @@
+package campaign
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"sample-golang/pkg/sendwindow"
+	"sample-golang/pkg/utils"
+)
+
+// ErrUnknownCampaign is returned when a slug isn't in the registry
+var ErrUnknownCampaign = errors.New("unknown campaign")
+
+// Campaign is one town's sign-up flow
+type Campaign struct {
+	Slug            string         `json:"slug"`
+	Name            string         `json:"name"`
+	FormURL         string         `json:"form_url"`
+	ReminderFormURL string         `json:"reminder_form_url"`
+	PartialTable    string         `json:"partial_table"`
+	R2ETable        string         `json:"r2e_table"`
+	TextMagicList   string         `json:"textmagic_list"`
+	ReminderDelay   utils.Duration `json:"reminder_delay"`
+	// ReminderMessage is a text/template, e.g. "Hi {{.First}}, finish here: {{.Link}}"
+	ReminderMessage string `json:"reminder_message"`
+	// Templates defines named templates for this campaign, overriding shared ones
+	Templates map[string]string `json:"templates,omitempty"`
+	// Sequence names the reminder sequence; without one, a single reminder is
+	// sent after ReminderDelay
+	Sequence string `json:"sequence,omitempty"`
+	// SendWindow overrides the hours reminders may be sent; start and end are required
+	SendWindow *sendwindow.Window `json:"send_window,omitempty"`
+}
+
+// SequenceName returns the reminder sequence registrants are started on
+func (c Campaign) SequenceName() string {
+	if c.Sequence != "" {
+		return c.Sequence
+	}
+	return "reminder:" + c.Slug
+}
+
+// withDefaults fills fields left empty in the config file from defaults
+func (c Campaign) withDefaults(defaults Campaign) Campaign {
+	fill := func(value *string, fallback string) {
+		if *value == "" {
+			*value = fallback
+		}
+	}
+
+	fill(&c.Name, c.Slug)
+	fill(&c.ReminderFormURL, defaults.ReminderFormURL)
+	fill(&c.PartialTable, defaults.PartialTable)
+	fill(&c.R2ETable, defaults.R2ETable)
+	fill(&c.TextMagicList, defaults.TextMagicList)
+	fill(&c.ReminderMessage, defaults.ReminderMessage)
+	if c.ReminderDelay == 0 {
+		c.ReminderDelay = defaults.ReminderDelay
+	}
+	return c
+}
+
+func (c Campaign) validate() error {
+	switch {
+	case c.Slug == "":
+		return errors.New("campaign is missing a slug")
+	case c.FormURL == "":
+		return fmt.Errorf("campaign %s is missing form_url", c.Slug)
+	case c.ReminderFormURL == "":
+		return fmt.Errorf("campaign %s is missing reminder_form_url", c.Slug)
+	case c.ReminderDelay <= 0:
+		return fmt.Errorf("campaign %s needs a positive reminder_delay", c.Slug)
+	}
+	return nil
+}
+
+// Registry looks up campaigns by slug
+type Registry interface {
+	// Get returns the campaign for slug, or the default campaign if slug is empty
+	Get(slug string) (Campaign, error)
+	List() []Campaign
+}
+
+type registryImpl struct {
+	campaigns   map[string]Campaign
+	order       []string
+	defaultSlug string
+}
+
+// NewRegistry creates a registry; defaultSlug must be one of the campaigns
+func NewRegistry(campaigns []Campaign, defaultSlug string) (Registry, error) {
+	r := &registryImpl{
+		campaigns:   make(map[string]Campaign),
+		defaultSlug: defaultSlug,
+	}
+
+	for _, c := range campaigns {
+		if err := c.validate(); err != nil {
+			return nil, err
+		}
+		if _, exists := r.campaigns[c.Slug]; exists {
+			return nil, fmt.Errorf("campaign %s is defined more than once", c.Slug)
+		}
+		r.campaigns[c.Slug] = c
+		r.order = append(r.order, c.Slug)
+	}
+
+	if _, ok := r.campaigns[defaultSlug]; !ok {
+		return nil, fmt.Errorf("default campaign %q is not defined", defaultSlug)
+	}
+	return r, nil
+}
+
+// LoadFile reads a registry from a JSON file shaped like
+// {"default": "burlington", "campaigns": [{"slug": "burlington", ...}]}.
+// Fields a campaign leaves empty are taken from defaults.
+func LoadFile(path string, defaults Campaign) (Registry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading campaigns file: %w", err)
+	}
+
+	var file struct {
+		Default   string     `json:"default"`
+		Campaigns []Campaign `json:"campaigns"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("error parsing campaigns file: %w", err)
+	}
+
+	campaigns := make([]Campaign, len(file.Campaigns))
+	for i, c := range file.Campaigns {
+		campaigns[i] = c.withDefaults(defaults)
+	}
+
+	if file.Default == "" && len(campaigns) == 1 {
+		file.Default = campaigns[0].Slug
+	}
+	return NewRegistry(campaigns, file.Default)
+}
+
+func (r *registryImpl) Get(slug string) (Campaign, error) {
+	if slug == "" {
+		slug = r.defaultSlug
+	}
+
+	c, ok := r.campaigns[slug]
+	if !ok {
+		return Campaign{}, fmt.Errorf("%w: %q", ErrUnknownCampaign, slug)
+	}
+	return c, nil
+}
+
+func (r *registryImpl) List() []Campaign {
+	campaigns := make([]Campaign, 0, len(r.order))
+	for _, slug := range r.order {
+		campaigns = append(campaigns, r.campaigns[slug])
+	}
+	return campaigns
+}
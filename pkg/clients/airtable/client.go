@@ -2,39 +2,77 @@ package airtable
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"net/url"
+	"strings"
+	"time"
+
+	"sample-golang/pkg/retry"
 )
 
+// requestTimeout bounds a single HTTP request to the Airtable API
+const requestTimeout = 15 * time.Second
+
+// updateBatchSize is the most records Airtable accepts in one update request
+const updateBatchSize = 10
+
 // Client defines the interface for interacting with Airtable API
 type Client interface {
-	RecordExists(table, phoneHash string) (bool, error)
-	CreateRecord(table string, data map[string]interface{}) error
+	// RecordExists reports whether any record's field matches one of phoneHashes
+	RecordExists(ctx context.Context, table, field string, phoneHashes ...string) (bool, error)
+	CreateRecord(ctx context.Context, table string, data map[string]interface{}) error
+	ListRecords(ctx context.Context, table string, fields ...string) ([]Record, error)
+	UpdateRecords(ctx context.Context, table string, records []Record) error
+
+	// GetTable looks up a table's ID and field IDs by name or ID
+	GetTable(ctx context.Context, table string) (Table, error)
+	CreateWebhook(ctx context.Context, notificationURL string, spec WebhookSpecification) (CreatedWebhook, error)
+	// RefreshWebhook extends a webhook's life, as Airtable expires them after 7 days
+	RefreshWebhook(ctx context.Context, webhookID string) (time.Time, error)
+	ListWebhooks(ctx context.Context) ([]Webhook, error)
+	DeleteWebhook(ctx context.Context, webhookID string) error
+	// WebhookPayloads returns the payloads from cursor on; Airtable starts cursors at 1
+	WebhookPayloads(ctx context.Context, webhookID string, cursor int) (PayloadPage, error)
+}
+
+// Record is a row in an Airtable table
+type Record struct {
+	ID     string                 `json:"id"`
+	Fields map[string]interface{} `json:"fields"`
 }
 
 type clientImpl struct {
-	apiKey string
-	baseID string
+	apiKey     string
+	baseID     string
+	limiter    *limiter
+	httpClient *http.Client
 }
 
-// NewClient creates a new Airtable client
-func NewClient(apiKey, baseID string) Client {
+// NewClient creates a new Airtable client that sends at most requestsPerSecond
+// to the base. The limit is kept in this process, so when several instances
+// share a base, give each its share of MaxRequestsPerSecond.
+func NewClient(apiKey, baseID string, requestsPerSecond float64) Client {
 	return &clientImpl{
-		apiKey: apiKey,
-		baseID: baseID,
+		apiKey:  apiKey,
+		baseID:  baseID,
+		limiter: limiterForBase(baseID, requestsPerSecond),
+		httpClient: &http.Client{
+			Timeout: requestTimeout,
+		},
 	}
 }
 
-func (c *clientImpl) RecordExists(table, phoneHash string) (bool, error) {
+func (c *clientImpl) RecordExists(ctx context.Context, table, field string, phoneHashes ...string) (bool, error) {
 	// URL for filtering records by phone hash
-	url := fmt.Sprintf("https://api.airtable.com/v0/%s/%s?filterByFormula={hash}=\"%s\"",
-		c.baseID, url.PathEscape(table), url.QueryEscape(phoneHash))
+	url := fmt.Sprintf("https://api.airtable.com/v0/%s/%s?filterByFormula=%s",
+		c.baseID, url.PathEscape(table), url.QueryEscape(hashFormula(field, phoneHashes)))
 
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return false, fmt.Errorf("error creating request: %w", err)
 	}
@@ -42,10 +80,9 @@ func (c *clientImpl) RecordExists(table, phoneHash string) (bool, error) {
 	// Add authentication header
 	req.Header.Add("Authorization", "Bearer "+c.apiKey)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
-		return false, fmt.Errorf("error checking Airtable: %w", err)
+		return false, newTransportError("checking Airtable", err)
 	}
 	defer resp.Body.Close()
 
@@ -56,7 +93,7 @@ func (c *clientImpl) RecordExists(table, phoneHash string) (bool, error) {
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return false, fmt.Errorf("error from Airtable API: %s", string(body))
+		return false, newAPIError(resp, body)
 	}
 
 	// Parse response
@@ -72,12 +109,24 @@ func (c *clientImpl) RecordExists(table, phoneHash string) (bool, error) {
 
 	// Record exists if we got any records back
 	exists := len(response.Records) > 0
-	log.Printf("Airtable record check for hash %s in table %s: exists=%v", phoneHash, table, exists)
+	log.Printf("Airtable record check for hash %s in table %s: exists=%v", strings.Join(phoneHashes, ","), table, exists)
 
 	return exists, nil
 }
 
-func (c *clientImpl) CreateRecord(table string, data map[string]interface{}) error {
+// hashFormula builds a formula matching records whose field is any of phoneHashes
+func hashFormula(field string, phoneHashes []string) string {
+	conditions := make([]string, len(phoneHashes))
+	for i, hash := range phoneHashes {
+		conditions[i] = fmt.Sprintf("{%s}=%q", field, hash)
+	}
+	if len(conditions) == 1 {
+		return conditions[0]
+	}
+	return "OR(" + strings.Join(conditions, ",") + ")"
+}
+
+func (c *clientImpl) CreateRecord(ctx context.Context, table string, data map[string]interface{}) error {
 	url := fmt.Sprintf("https://api.airtable.com/v0/%s/%s", c.baseID, url.PathEscape(table))
 
 	// Format data for Airtable API
@@ -94,7 +143,7 @@ func (c *clientImpl) CreateRecord(table string, data map[string]interface{}) err
 		return fmt.Errorf("error creating payload: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonPayload))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonPayload))
 	if err != nil {
 		return fmt.Errorf("error creating request: %w", err)
 	}
@@ -103,10 +152,10 @@ func (c *clientImpl) CreateRecord(table string, data map[string]interface{}) err
 	req.Header.Add("Authorization", "Bearer "+c.apiKey)
 	req.Header.Add("Content-Type", "application/json")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	req, wrote := retry.TraceWrite(req)
+	resp, err := c.do(req)
 	if err != nil {
-		return fmt.Errorf("error creating Airtable record: %w", err)
+		return newUnsentError("creating Airtable record", err, wrote())
 	}
 	defer resp.Body.Close()
 
@@ -117,9 +166,123 @@ func (c *clientImpl) CreateRecord(table string, data map[string]interface{}) err
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("error from Airtable API: %s", string(body))
+		return newAPIError(resp, body)
 	}
 
 	log.Printf("Successfully created record in Airtable table: %s", table)
 	return nil
 }
+
+// ListRecords returns every record in the table, following Airtable's pagination.
+// Only the named fields are returned if any are given.
+func (c *clientImpl) ListRecords(ctx context.Context, table string, fields ...string) ([]Record, error) {
+	var records []Record
+	offset := ""
+
+	for {
+		params := url.Values{}
+		for _, field := range fields {
+			params.Add("fields[]", field)
+		}
+		if offset != "" {
+			params.Set("offset", offset)
+		}
+
+		listURL := fmt.Sprintf("https://api.airtable.com/v0/%s/%s?%s", c.baseID, url.PathEscape(table), params.Encode())
+		req, err := http.NewRequestWithContext(ctx, "GET", listURL, nil)
+		if err != nil {
+			return nil, fmt.Errorf("error creating request: %w", err)
+		}
+		req.Header.Add("Authorization", "Bearer "+c.apiKey)
+
+		resp, err := c.do(req)
+		if err != nil {
+			return nil, newTransportError("listing Airtable records", err)
+		}
+
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error reading response: %w", err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, newAPIError(resp, body)
+		}
+
+		var page struct {
+			Records []Record `json:"records"`
+			Offset  string   `json:"offset"`
+		}
+		if err := json.Unmarshal(body, &page); err != nil {
+			return nil, fmt.Errorf("error parsing response: %w", err)
+		}
+
+		records = append(records, page.Records...)
+		if page.Offset == "" {
+			return records, nil
+		}
+		offset = page.Offset
+	}
+}
+
+// UpdateRecords sets the given fields on existing records, leaving other fields unchanged
+func (c *clientImpl) UpdateRecords(ctx context.Context, table string, records []Record) error {
+	updateURL := fmt.Sprintf("https://api.airtable.com/v0/%s/%s", c.baseID, url.PathEscape(table))
+
+	for start := 0; start < len(records); start += updateBatchSize {
+		end := start + updateBatchSize
+		if end > len(records) {
+			end = len(records)
+		}
+
+		jsonPayload, err := json.Marshal(map[string]interface{}{
+			"records": records[start:end],
+		})
+		if err != nil {
+			return fmt.Errorf("error creating payload: %w", err)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, "PATCH", updateURL, bytes.NewBuffer(jsonPayload))
+		if err != nil {
+			return fmt.Errorf("error creating request: %w", err)
+		}
+		req.Header.Add("Authorization", "Bearer "+c.apiKey)
+		req.Header.Add("Content-Type", "application/json")
+
+		resp, err := c.do(req)
+		if err != nil {
+			return newTransportError("updating Airtable records", err)
+		}
+
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("error reading response: %w", err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			return newAPIError(resp, body)
+		}
+	}
+
+	log.Printf("Successfully updated %d records in Airtable table: %s", len(records), table)
+	return nil
+}
+
+// do sends a request once the base's rate limiter allows it
+func (c *clientImpl) do(req *http.Request) (*http.Response, error) {
+	if err := c.limiter.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		c.limiter.Cooldown(rateLimitCooldown)
+	}
+	return resp, nil
+}
@@ -0,0 +1,128 @@
+package airtable
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// MaxRequestsPerSecond is Airtable's limit for each base
+	MaxRequestsPerSecond = 5
+
+	// Airtable blocks a base for 30 seconds after it returns a 429
+	rateLimitCooldown = 30 * time.Second
+)
+
+var (
+	limiters   = make(map[string]*limiter)
+	limitersMu sync.Mutex
+)
+
+// limiter is a token bucket that hands out reservations in arrival order. It
+// only paces the requests of this process, so instances sharing a base must
+// split Airtable's limit between them; a 429 still pauses the one that got it.
+type limiter struct {
+	rate          float64
+	burst         float64
+	tokens        float64
+	last          time.Time
+	cooldownUntil time.Time
+	mu            sync.Mutex
+}
+
+// limiterForBase returns the limiter shared by every client in this process
+// using baseID. The first client's rate applies.
+func limiterForBase(baseID string, rate float64) *limiter {
+	limitersMu.Lock()
+	defer limitersMu.Unlock()
+
+	l, ok := limiters[baseID]
+	if !ok {
+		if rate <= 0 || rate > MaxRequestsPerSecond {
+			rate = MaxRequestsPerSecond
+		}
+		// Allow at least one request at a time however low the rate
+		l = newLimiter(rate, max(int(rate), 1))
+		limiters[baseID] = l
+	}
+	return l
+}
+
+func newLimiter(rate float64, burst int) *limiter {
+	return &limiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Wait blocks until a request may be sent or ctx is done
+func (l *limiter) Wait(ctx context.Context) error {
+	delay := l.reserve()
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.cancel()
+		return ctx.Err()
+	}
+}
+
+// Cooldown pauses all requests for d after Airtable rejected one with a 429
+func (l *limiter) Cooldown(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	until := time.Now().Add(d)
+	if until.After(l.cooldownUntil) {
+		l.cooldownUntil = until
+		// Start from an empty bucket so callers don't burst as soon as the penalty ends
+		l.tokens = 0
+		l.last = until
+		log.Printf("Airtable rate limit hit, pausing requests until %s", until.Format(time.RFC3339))
+	}
+}
+
+// reserve takes a token and returns how long the caller must wait to use it
+func (l *limiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.After(l.last) {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+		l.last = now
+	}
+
+	l.tokens--
+
+	// A negative balance means the token will be available in the future
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	if wait := l.last.Sub(now); wait > 0 {
+		delay += wait
+	}
+	return delay
+}
+
+// cancel returns an unused reservation to the bucket
+func (l *limiter) cancel() {
+	l.mu.Lock()
+	l.tokens++
+	l.mu.Unlock()
+}
@@ -0,0 +1,280 @@
+package airtable
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MACHeader carries the signature Airtable sends with webhook notifications
+const MACHeader = "X-Airtable-Content-MAC"
+
+// Webhook is a subscription to changes in a base
+type Webhook struct {
+	ID                   string               `json:"id"`
+	NotificationURL      string               `json:"notificationUrl"`
+	IsHookEnabled        bool                 `json:"isHookEnabled"`
+	CursorForNextPayload int                  `json:"cursorForNextPayload"`
+	ExpirationTime       time.Time            `json:"expirationTime"`
+	Specification        WebhookSpecification `json:"specification"`
+}
+
+// WebhookSpecification selects which changes a webhook reports
+type WebhookSpecification struct {
+	Options struct {
+		Filters struct {
+			DataTypes         []string `json:"dataTypes"`
+			RecordChangeScope string   `json:"recordChangeScope,omitempty"`
+			ChangeTypes       []string `json:"changeTypes,omitempty"`
+		} `json:"filters"`
+		Includes *WebhookIncludes `json:"includes,omitempty"`
+	} `json:"options"`
+}
+
+// WebhookIncludes adds extra data to webhook payloads
+type WebhookIncludes struct {
+	IncludeCellValuesInFieldIDs []string `json:"includeCellValuesInFieldIds,omitempty"`
+}
+
+// NewTableSpecification watches a table for added and updated records, including
+// the values of the given fields in payloads
+func NewTableSpecification(tableID string, fieldIDs ...string) WebhookSpecification {
+	var spec WebhookSpecification
+	spec.Options.Filters.DataTypes = []string{"tableData"}
+	spec.Options.Filters.RecordChangeScope = tableID
+	spec.Options.Filters.ChangeTypes = []string{"add", "update"}
+	if len(fieldIDs) > 0 {
+		spec.Options.Includes = &WebhookIncludes{IncludeCellValuesInFieldIDs: fieldIDs}
+	}
+	return spec
+}
+
+// CreatedWebhook is returned once when a webhook is created. The MAC secret
+// can't be fetched again, so callers must keep it.
+type CreatedWebhook struct {
+	ID              string    `json:"id"`
+	MACSecretBase64 string    `json:"macSecretBase64"`
+	ExpirationTime  time.Time `json:"expirationTime"`
+}
+
+// WebhookPayload describes one transaction in the base
+type WebhookPayload struct {
+	Timestamp             time.Time               `json:"timestamp"`
+	BaseTransactionNumber int                     `json:"baseTransactionNumber"`
+	ChangedTablesByID     map[string]TableChanges `json:"changedTablesById"`
+}
+
+// TableChanges lists the records a transaction touched in one table
+type TableChanges struct {
+	CreatedRecordsByID map[string]struct {
+		CellValuesByFieldID map[string]interface{} `json:"cellValuesByFieldId"`
+	} `json:"createdRecordsById"`
+	ChangedRecordsByID map[string]struct {
+		Current struct {
+			CellValuesByFieldID map[string]interface{} `json:"cellValuesByFieldId"`
+		} `json:"current"`
+		// Unchanged holds included fields the change didn't touch
+		Unchanged struct {
+			CellValuesByFieldID map[string]interface{} `json:"cellValuesByFieldId"`
+		} `json:"unchanged"`
+	} `json:"changedRecordsById"`
+	DestroyedRecordIDs []string `json:"destroyedRecordIds"`
+}
+
+// CellValues returns the current values of a field in records created or
+// changed, whether or not the change touched the field
+func (t TableChanges) CellValues(fieldID string) []interface{} {
+	var values []interface{}
+	for _, record := range t.CreatedRecordsByID {
+		if value, ok := record.CellValuesByFieldID[fieldID]; ok {
+			values = append(values, value)
+		}
+	}
+	for _, record := range t.ChangedRecordsByID {
+		if value, ok := record.Current.CellValuesByFieldID[fieldID]; ok {
+			values = append(values, value)
+		} else if value, ok := record.Unchanged.CellValuesByFieldID[fieldID]; ok {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// PayloadPage is a batch of webhook payloads starting at a cursor
+type PayloadPage struct {
+	Payloads      []WebhookPayload `json:"payloads"`
+	Cursor        int              `json:"cursor"`
+	MightHaveMore bool             `json:"mightHaveMore"`
+}
+
+// Table describes a table's ID and fields, as webhook payloads refer to both by ID
+type Table struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Fields []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"fields"`
+}
+
+// FieldID returns the ID of the named field, or "" if the table has none
+func (t Table) FieldID(name string) string {
+	for _, field := range t.Fields {
+		if field.Name == name || field.ID == name {
+			return field.ID
+		}
+	}
+	return ""
+}
+
+// Notification is the body Airtable posts to a webhook's URL. It only says that
+// new payloads are waiting; they are fetched with WebhookPayloads.
+type Notification struct {
+	Base struct {
+		ID string `json:"id"`
+	} `json:"base"`
+	Webhook struct {
+		ID string `json:"id"`
+	} `json:"webhook"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// VerifyNotification checks the MAC header Airtable signs notifications with
+func VerifyNotification(macSecretBase64 string, body []byte, header string) bool {
+	secret, err := base64.StdEncoding.DecodeString(macSecretBase64)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	expected := "hmac-sha256=" + hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(header))
+}
+
+// GetTable looks up a table in the base by name or ID
+func (c *clientImpl) GetTable(ctx context.Context, table string) (Table, error) {
+	var response struct {
+		Tables []Table `json:"tables"`
+	}
+	schemaURL := fmt.Sprintf("https://api.airtable.com/v0/meta/bases/%s/tables", c.baseID)
+	if err := c.call(ctx, "GET", schemaURL, nil, &response, "reading Airtable schema"); err != nil {
+		return Table{}, err
+	}
+
+	for _, t := range response.Tables {
+		if t.Name == table || t.ID == table {
+			return t, nil
+		}
+	}
+	return Table{}, fmt.Errorf("table %q not found in base", table)
+}
+
+func (c *clientImpl) CreateWebhook(ctx context.Context, notificationURL string, spec WebhookSpecification) (CreatedWebhook, error) {
+	var created CreatedWebhook
+	payload := map[string]interface{}{
+		"notificationUrl": notificationURL,
+		"specification":   spec,
+	}
+	if err := c.call(ctx, "POST", c.webhooksURL(), payload, &created, "creating Airtable webhook"); err != nil {
+		return CreatedWebhook{}, err
+	}
+	return created, nil
+}
+
+func (c *clientImpl) RefreshWebhook(ctx context.Context, webhookID string) (time.Time, error) {
+	var response struct {
+		ExpirationTime time.Time `json:"expirationTime"`
+	}
+	if err := c.call(ctx, "POST", c.webhooksURL(webhookID, "refresh"), nil, &response, "refreshing Airtable webhook"); err != nil {
+		return time.Time{}, err
+	}
+	return response.ExpirationTime, nil
+}
+
+func (c *clientImpl) ListWebhooks(ctx context.Context) ([]Webhook, error) {
+	var response struct {
+		Webhooks []Webhook `json:"webhooks"`
+	}
+	if err := c.call(ctx, "GET", c.webhooksURL(), nil, &response, "listing Airtable webhooks"); err != nil {
+		return nil, err
+	}
+	return response.Webhooks, nil
+}
+
+func (c *clientImpl) DeleteWebhook(ctx context.Context, webhookID string) error {
+	return c.call(ctx, "DELETE", c.webhooksURL(webhookID), nil, nil, "deleting Airtable webhook")
+}
+
+func (c *clientImpl) WebhookPayloads(ctx context.Context, webhookID string, cursor int) (PayloadPage, error) {
+	params := url.Values{}
+	params.Set("cursor", strconv.Itoa(cursor))
+
+	var page PayloadPage
+	payloadsURL := c.webhooksURL(webhookID, "payloads") + "?" + params.Encode()
+	if err := c.call(ctx, "GET", payloadsURL, nil, &page, "fetching Airtable webhook payloads"); err != nil {
+		return PayloadPage{}, err
+	}
+	return page, nil
+}
+
+// webhooksURL builds a webhooks API URL, e.g. webhooksURL(id, "refresh")
+func (c *clientImpl) webhooksURL(path ...string) string {
+	base := fmt.Sprintf("https://api.airtable.com/v0/bases/%s/webhooks", c.baseID)
+	return strings.Join(append([]string{base}, path...), "/")
+}
+
+// call sends a JSON request and decodes the JSON response into out, if given
+func (c *clientImpl) call(ctx context.Context, method, requestURL string, payload, out interface{}, op string) error {
+	var reqBody io.Reader
+	if payload != nil {
+		jsonPayload, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("error creating payload: %w", err)
+		}
+		reqBody = bytes.NewBuffer(jsonPayload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, requestURL, reqBody)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Add("Authorization", "Bearer "+c.apiKey)
+	if payload != nil {
+		req.Header.Add("Content-Type", "application/json")
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return newTransportError(op, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return newAPIError(resp, body)
+	}
+
+	if out == nil || len(body) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("error parsing response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package airtable
+
+import (
+	"encoding/json"
+	"sort"
+	"testing"
+)
+
+func TestCellValues(t *testing.T) {
+	// A created record, a record whose hash changed and one where only
+	// another field changed, so its hash comes under "unchanged"
+	raw := `{
+		"createdRecordsById": {
+			"rec1": {"cellValuesByFieldId": {"fldHash": "created"}}
+		},
+		"changedRecordsById": {
+			"rec2": {"current": {"cellValuesByFieldId": {"fldHash": "changed"}}},
+			"rec3": {
+				"current": {"cellValuesByFieldId": {"fldName": "Ada"}},
+				"unchanged": {"cellValuesByFieldId": {"fldHash": "unchanged"}}
+			},
+			"rec4": {"current": {"cellValuesByFieldId": {"fldName": "Grace"}}}
+		}
+	}`
+
+	var changes TableChanges
+	if err := json.Unmarshal([]byte(raw), &changes); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+
+	var got []string
+	for _, value := range changes.CellValues("fldHash") {
+		got = append(got, value.(string))
+	}
+	sort.Strings(got)
+
+	want := []string{"changed", "created", "unchanged"}
+	if len(got) != len(want) {
+		t.Fatalf("CellValues = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("CellValues = %q, want %q", got, want)
+			break
+		}
+	}
+}
+
+func TestHashFormula(t *testing.T) {
+	tests := []struct {
+		field  string
+		hashes []string
+		want   string
+	}{
+		{"hash", []string{"v2:a"}, `{hash}="v2:a"`},
+		{"Phone Hash", []string{"v2:a"}, `{Phone Hash}="v2:a"`},
+		{"hash", []string{"v2:a", "v1:b"}, `OR({hash}="v2:a",{hash}="v1:b")`},
+	}
+
+	for _, tt := range tests {
+		if got := hashFormula(tt.field, tt.hashes); got != tt.want {
+			t.Errorf("hashFormula(%q, %q) = %s, want %s", tt.field, tt.hashes, got, tt.want)
+		}
+	}
+}
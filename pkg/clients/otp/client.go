@@ -0,0 +1,150 @@
+package otp
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"math/big"
+	"time"
+
+	"sample-golang/pkg/clients/twilio"
+)
+
+// messageTemplate is the SMS body sent with each code
+const messageTemplate = "Your DemocracyOS verification code is %s"
+
+// MinCodeLength keeps codes long enough that the guess limit protects them
+const MinCodeLength = 4
+
+// Sender sends a text message to a phone number, such as textmagic.Client
+type Sender interface {
+	SendMessageToPhone(ctx context.Context, phone, message string) (string, error)
+}
+
+// Code is an issued code, stored as a salted hash so it can't be read back
+type Code struct {
+	Hash      []byte    `json:"hash"`
+	Salt      []byte    `json:"salt"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// CodeStore keeps issued codes where every instance can check them, such as
+// alongside pending verifications. GetCode returns nil without an error when
+// the phone has no code, and DeleteCode reports whether there was one to delete.
+type CodeStore interface {
+	SaveCode(phone string, code Code) error
+	GetCode(phone string) (*Code, error)
+	DeleteCode(phone string) (bool, error)
+}
+
+type clientImpl struct {
+	sender     Sender
+	codes      CodeStore
+	codeLength int
+	ttl        time.Duration
+}
+
+// NewClient creates a self-hosted verification client that generates codes,
+// sends them through sender and keeps them in codes, in place of Twilio Verify
+func NewClient(sender Sender, codes CodeStore, codeLength int, ttl time.Duration) (twilio.Client, error) {
+	if codeLength < MinCodeLength {
+		return nil, fmt.Errorf("code length %d is below the minimum of %d", codeLength, MinCodeLength)
+	}
+
+	return &clientImpl{
+		sender:     sender,
+		codes:      codes,
+		codeLength: codeLength,
+		ttl:        ttl,
+	}, nil
+}
+
+// SendVerificationCode only delivers by SMS; other channels fail with ErrUnsupportedChannel
+func (c *clientImpl) SendVerificationCode(ctx context.Context, phoneNumber string, channel twilio.Channel) error {
+	if channel != twilio.ChannelSMS {
+		return fmt.Errorf("%w: %s", twilio.ErrUnsupportedChannel, channel)
+	}
+	if err := channel.Validate(phoneNumber); err != nil {
+		return err
+	}
+
+	value, err := generateCode(c.codeLength)
+	if err != nil {
+		return fmt.Errorf("error generating verification code: %w", err)
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return fmt.Errorf("error generating verification code: %w", err)
+	}
+
+	// Save before sending so a delivered code can always be checked. A new code
+	// replaces any earlier one for the phone.
+	err = c.codes.SaveCode(phoneNumber, Code{
+		Hash:      hashCode(salt, phoneNumber, value),
+		Salt:      salt,
+		ExpiresAt: time.Now().Add(c.ttl),
+	})
+	if err != nil {
+		return fmt.Errorf("error saving verification code: %w", err)
+	}
+
+	messageID, err := c.sender.SendMessageToPhone(ctx, phoneNumber, fmt.Sprintf(messageTemplate, value))
+	if err != nil {
+		// The phone never got this code, so it shouldn't stay checkable
+		if _, deleteErr := c.codes.DeleteCode(phoneNumber); deleteErr != nil {
+			log.Printf("Error deleting unsent verification code: %v", deleteErr)
+		}
+		return fmt.Errorf("error sending verification code: %w", err)
+	}
+
+	log.Printf("Sent verification code to: %s, message: %s", phoneNumber, messageID)
+	return nil
+}
+
+func (c *clientImpl) CheckVerificationCode(ctx context.Context, phoneNumber, value string) (bool, error) {
+	issued, err := c.codes.GetCode(phoneNumber)
+	if err != nil {
+		return false, fmt.Errorf("error loading verification code: %w", err)
+	}
+
+	if issued == nil || time.Now().After(issued.ExpiresAt) {
+		log.Printf("Verification check for %s: no active code", phoneNumber)
+		return false, nil
+	}
+
+	verified := hmac.Equal(issued.Hash, hashCode(issued.Salt, phoneNumber, value))
+	if verified {
+		// Codes are single use, so only the check that deletes it succeeds
+		verified, err = c.codes.DeleteCode(phoneNumber)
+		if err != nil {
+			return false, fmt.Errorf("error deleting verification code: %w", err)
+		}
+	}
+
+	log.Printf("Verification check for %s: %v", phoneNumber, verified)
+	return verified, nil
+}
+
+// generateCode returns a uniformly random numeric code of the given length
+func generateCode(length int) (string, error) {
+	digits := make([]byte, length)
+	for i := range digits {
+		n, err := rand.Int(rand.Reader, big.NewInt(10))
+		if err != nil {
+			return "", err
+		}
+		digits[i] = byte('0' + n.Int64())
+	}
+	return string(digits), nil
+}
+
+// hashCode binds a code to its phone so a hash can't be replayed for another number
+func hashCode(salt []byte, phone, value string) []byte {
+	mac := hmac.New(sha256.New, salt)
+	mac.Write([]byte(phone + ":" + value))
+	return mac.Sum(nil)
+}
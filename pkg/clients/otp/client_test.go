@@ -0,0 +1,154 @@
+package otp
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"sample-golang/pkg/clients/twilio"
+)
+
+const testPhone = "+15555550100"
+
+type fakeSender struct {
+	last string
+	err  error
+}
+
+func (f *fakeSender) SendMessageToPhone(ctx context.Context, phone, message string) (string, error) {
+	if f.err != nil {
+		return "", f.err
+	}
+	f.last = message
+	return "1", nil
+}
+
+// sentCode reads the code back out of the last message
+func (f *fakeSender) sentCode() string {
+	fields := strings.Fields(f.last)
+	return fields[len(fields)-1]
+}
+
+type mapCodeStore struct {
+	codes map[string]Code
+	mu    sync.Mutex
+}
+
+func (s *mapCodeStore) SaveCode(phone string, code Code) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.codes[phone] = code
+	return nil
+}
+
+func (s *mapCodeStore) GetCode(phone string) (*Code, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	code, ok := s.codes[phone]
+	if !ok {
+		return nil, nil
+	}
+	return &code, nil
+}
+
+func (s *mapCodeStore) DeleteCode(phone string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.codes[phone]
+	delete(s.codes, phone)
+	return ok, nil
+}
+
+func newTestClient(t *testing.T, sender Sender, store CodeStore, ttl time.Duration) twilio.Client {
+	t.Helper()
+	client, err := NewClient(sender, store, 6, ttl)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	return client
+}
+
+func TestNewClientCodeLength(t *testing.T) {
+	tests := []struct {
+		length  int
+		wantErr bool
+	}{
+		{0, true},
+		{3, true},
+		{4, false},
+		{8, false},
+	}
+
+	for _, tt := range tests {
+		_, err := NewClient(&fakeSender{}, &mapCodeStore{codes: make(map[string]Code)}, tt.length, time.Minute)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NewClient with length %d: err = %v, wantErr %v", tt.length, err, tt.wantErr)
+		}
+	}
+}
+
+func TestSendVerificationCodeFailure(t *testing.T) {
+	store := &mapCodeStore{codes: make(map[string]Code)}
+	client := newTestClient(t, &fakeSender{err: errors.New("gateway down")}, store, time.Minute)
+
+	if err := client.SendVerificationCode(context.Background(), testPhone, twilio.ChannelSMS); err == nil {
+		t.Fatal("SendVerificationCode succeeded with a failing sender")
+	}
+	if code, _ := store.GetCode(testPhone); code != nil {
+		t.Error("kept a code that was never sent")
+	}
+}
+
+func TestCheckVerificationCode(t *testing.T) {
+	ctx := context.Background()
+	sender := &fakeSender{}
+	store := &mapCodeStore{codes: make(map[string]Code)}
+
+	// Instances share codes through the store
+	sending := newTestClient(t, sender, store, time.Minute)
+	checking := newTestClient(t, sender, store, time.Minute)
+
+	if err := sending.SendVerificationCode(ctx, testPhone, twilio.ChannelSMS); err != nil {
+		t.Fatalf("SendVerificationCode: %v", err)
+	}
+	code := sender.sentCode()
+
+	tests := []struct {
+		name  string
+		phone string
+		code  string
+		want  bool
+	}{
+		{"wrong code", testPhone, "not-it", false},
+		{"code for another phone", "+15555550199", code, false},
+		{"right code", testPhone, code, true},
+		{"code is single use", testPhone, code, false},
+	}
+
+	for _, tt := range tests {
+		got, err := checking.CheckVerificationCode(ctx, tt.phone, tt.code)
+		if err != nil {
+			t.Fatalf("%s: CheckVerificationCode: %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: verified = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCheckVerificationCodeExpired(t *testing.T) {
+	ctx := context.Background()
+	sender := &fakeSender{}
+	store := &mapCodeStore{codes: make(map[string]Code)}
+	client := newTestClient(t, sender, store, -time.Second)
+
+	if err := client.SendVerificationCode(ctx, testPhone, twilio.ChannelSMS); err != nil {
+		t.Fatalf("SendVerificationCode: %v", err)
+	}
+	if verified, _ := client.CheckVerificationCode(ctx, testPhone, sender.sentCode()); verified {
+		t.Error("verified an expired code")
+	}
+}
@@ -2,21 +2,27 @@ package shortio
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"time"
 )
 
+// requestTimeout bounds a single HTTP request to the Short.io API
+const requestTimeout = 15 * time.Second
+
 // Client defines the interface for interacting with Short.io API
 type Client interface {
-	CreateShortLink(originalURL string) (string, error)
+	CreateShortLink(ctx context.Context, originalURL string) (string, error)
 }
 
 type clientImpl struct {
-	apiKey string
-	domain string
+	apiKey     string
+	domain     string
+	httpClient *http.Client
 }
 
 // NewClient creates a new Short.io client
@@ -24,10 +30,13 @@ func NewClient(apiKey, domain string) Client {
 	return &clientImpl{
 		apiKey: apiKey,
 		domain: domain,
+		httpClient: &http.Client{
+			Timeout: requestTimeout,
+		},
 	}
 }
 
-func (c *clientImpl) CreateShortLink(originalURL string) (string, error) {
+func (c *clientImpl) CreateShortLink(ctx context.Context, originalURL string) (string, error) {
 	url := "https://api.short.io/links"
 
 	// Create payload
@@ -41,7 +50,7 @@ func (c *clientImpl) CreateShortLink(originalURL string) (string, error) {
 		return "", fmt.Errorf("error creating payload: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonPayload))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonPayload))
 	if err != nil {
 		return "", fmt.Errorf("error creating request: %w", err)
 	}
@@ -50,10 +59,9 @@ func (c *clientImpl) CreateShortLink(originalURL string) (string, error) {
 	req.Header.Add("Authorization", c.apiKey)
 	req.Header.Add("Content-Type", "application/json")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("error creating short link: %w", err)
+		return "", newTransportError("creating short link", err)
 	}
 	defer resp.Body.Close()
 
@@ -64,7 +72,7 @@ func (c *clientImpl) CreateShortLink(originalURL string) (string, error) {
 	}
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		return "", fmt.Errorf("error from Short.io API: %s", string(body))
+		return "", newAPIError(resp, body)
 	}
 
 	// Parse response
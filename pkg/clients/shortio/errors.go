@@ -0,0 +1,80 @@
+package shortio
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"sample-golang/pkg/retry"
+)
+
+// APIError describes a failed call to the Short.io API
+type APIError struct {
+	StatusCode int
+	Code       string
+	Message    string
+	Op         string
+	Err        error
+	retryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("error %s: %v", e.Op, e.Err)
+	}
+	if e.Code != "" {
+		return fmt.Sprintf("error from Short.io API (status %d, code %s): %s", e.StatusCode, e.Code, e.Message)
+	}
+	return fmt.Sprintf("error from Short.io API (status %d): %s", e.StatusCode, e.Message)
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable reports whether the request failed for a transient reason
+func (e *APIError) Retryable() bool {
+	if e.Err != nil {
+		// A cancelled caller should not be retried, but a timed-out attempt can be
+		return !errors.Is(e.Err, context.Canceled)
+	}
+	return retry.IsRetryableStatus(e.StatusCode)
+}
+
+// RetryAfter returns the delay requested by the Retry-After header, if any
+func (e *APIError) RetryAfter() time.Duration {
+	return e.retryAfter
+}
+
+// newTransportError wraps a failure to reach the Short.io API
+func newTransportError(op string, err error) *APIError {
+	return &APIError{Op: op, Err: err}
+}
+
+// newAPIError classifies a non-successful Short.io response
+func newAPIError(resp *http.Response, body []byte) *APIError {
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		Message:    string(body),
+		retryAfter: retry.ParseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+
+	// Short.io errors look like {"code": "...", "error": "..."} or {"message": "..."}
+	var errorResponse struct {
+		Code    string `json:"code"`
+		Error   string `json:"error"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &errorResponse); err == nil {
+		apiErr.Code = errorResponse.Code
+		if errorResponse.Error != "" {
+			apiErr.Message = errorResponse.Error
+		} else if errorResponse.Message != "" {
+			apiErr.Message = errorResponse.Message
+		}
+	}
+	return apiErr
+}
@@ -2,6 +2,7 @@ package textmagic
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -9,18 +10,28 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
+
+	"sample-golang/pkg/phone"
+	"sample-golang/pkg/retry"
 )
 
+// requestTimeout bounds a single HTTP request to the TextMagic API
+const requestTimeout = 15 * time.Second
+
 // Client defines the interface for interacting with TextMagic API
 type Client interface {
-	GetOrCreateContact(phone, firstName, lastName string) (string, error)
-	SendMessage(contactID, message string) error
+	// GetOrCreateContact finds the contact for phone, or creates it in listID
+	GetOrCreateContact(ctx context.Context, phone, firstName, lastName, listID string) (string, error)
+	SendMessage(ctx context.Context, contactID, message string) (string, error)
+	SendMessageToPhone(ctx context.Context, phone, message string) (string, error)
 }
 
 type clientImpl struct {
-	apiKey   string
-	username string
-	baseURL  string
+	apiKey     string
+	username   string
+	baseURL    string
+	httpClient *http.Client
 }
 
 // NewClient creates a new TextMagic client
@@ -29,25 +40,24 @@ func NewClient(username, apiKey string) Client {
 		apiKey:   apiKey,
 		username: username,
 		baseURL:  "https://rest.textmagic.com/api/v2",
+		httpClient: &http.Client{
+			Timeout: requestTimeout,
+		},
 	}
 }
 
-func (c *clientImpl) GetOrCreateContact(phone, firstName, lastName string) (string, error) {
+func (c *clientImpl) GetOrCreateContact(ctx context.Context, phone, firstName, lastName, listID string) (string, error) {
 	// First, try to search for existing contact by phone number
-	phone = strings.ReplaceAll(phone, " ", "")
-	phone = strings.ReplaceAll(phone, "-", "")
-	phone = strings.ReplaceAll(phone, "(", "")
-	phone = strings.ReplaceAll(phone, ")", "")
-	// Add "1" to the beginning of the phone number if not already present
-	if !strings.HasPrefix(phone, "1") {
-		phone = "1" + phone
+	phone, err := normalizePhone(phone)
+	if err != nil {
+		return "", err
 	}
 
 	fmt.Println("Phone number after cleaning:", phone)
 
 	searchURL := fmt.Sprintf("%s/contacts/search?query=%s", c.baseURL, url.QueryEscape(phone))
 
-	req, err := http.NewRequest("GET", searchURL, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", searchURL, nil)
 	if err != nil {
 		return "", fmt.Errorf("error creating request: %w", err)
 	}
@@ -56,10 +66,9 @@ func (c *clientImpl) GetOrCreateContact(phone, firstName, lastName string) (stri
 	req.SetBasicAuth(c.username, c.apiKey)
 	req.Header.Add("Content-Type", "application/json")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("error searching for contact: %w", err)
+		return "", newTransportError("searching for contact", err)
 	}
 	defer resp.Body.Close()
 
@@ -70,7 +79,7 @@ func (c *clientImpl) GetOrCreateContact(phone, firstName, lastName string) (stri
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("error from TextMagic API: %s", string(body))
+		return "", newAPIError(resp, body)
 	}
 
 	// Parse response
@@ -102,7 +111,7 @@ func (c *clientImpl) GetOrCreateContact(phone, firstName, lastName string) (stri
 		"phone":     phone,
 		"firstName": firstName,
 		"lastName":  lastName,
-		"lists":     "4344890", // Customers List ID
+		"lists":     listID,
 	}
 
 	jsonPayload, err := json.Marshal(payload)
@@ -110,7 +119,7 @@ func (c *clientImpl) GetOrCreateContact(phone, firstName, lastName string) (stri
 		return "", fmt.Errorf("error creating payload: %w", err)
 	}
 
-	createReq, err := http.NewRequest("POST", createURL, bytes.NewBuffer(jsonPayload))
+	createReq, err := http.NewRequestWithContext(ctx, "POST", createURL, bytes.NewBuffer(jsonPayload))
 	if err != nil {
 		return "", fmt.Errorf("error creating request: %w", err)
 	}
@@ -119,9 +128,9 @@ func (c *clientImpl) GetOrCreateContact(phone, firstName, lastName string) (stri
 	createReq.SetBasicAuth(c.username, c.apiKey)
 	createReq.Header.Add("Content-Type", "application/json")
 
-	createResp, err := client.Do(createReq)
+	createResp, err := c.httpClient.Do(createReq)
 	if err != nil {
-		return "", fmt.Errorf("error creating contact: %w", err)
+		return "", newTransportError("creating contact", err)
 	}
 	defer createResp.Body.Close()
 
@@ -149,16 +158,16 @@ func (c *clientImpl) GetOrCreateContact(phone, firstName, lastName string) (stri
 			for _, msg := range errorResponse.Errors.Fields.Phone {
 				if strings.Contains(msg, "already exists in your contacts") {
 					// Search again to get the ID of the existing contact
-					return c.findContactByPhone(phone)
+					return c.findContactByPhone(ctx, phone)
 				}
 			}
 		}
 
-		return "", fmt.Errorf("error from TextMagic API: %s", string(createBody))
+		return "", newAPIError(createResp, createBody)
 	}
 
 	if createResp.StatusCode != http.StatusCreated {
-		return "", fmt.Errorf("error from TextMagic API: %s", string(createBody))
+		return "", newAPIError(createResp, createBody)
 	}
 
 	// Parse response
@@ -176,10 +185,10 @@ func (c *clientImpl) GetOrCreateContact(phone, firstName, lastName string) (stri
 }
 
 // Helper function to find a contact by phone number
-func (c *clientImpl) findContactByPhone(phone string) (string, error) {
+func (c *clientImpl) findContactByPhone(ctx context.Context, phone string) (string, error) {
 	searchURL := fmt.Sprintf("%s/contacts/search?query=%s", c.baseURL, url.QueryEscape(phone))
 
-	req, err := http.NewRequest("GET", searchURL, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", searchURL, nil)
 	if err != nil {
 		return "", fmt.Errorf("error creating request: %w", err)
 	}
@@ -187,10 +196,9 @@ func (c *clientImpl) findContactByPhone(phone string) (string, error) {
 	req.SetBasicAuth(c.username, c.apiKey)
 	req.Header.Add("Content-Type", "application/json")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("error searching for contact: %w", err)
+		return "", newTransportError("searching for contact", err)
 	}
 	defer resp.Body.Close()
 
@@ -200,7 +208,7 @@ func (c *clientImpl) findContactByPhone(phone string) (string, error) {
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("error from TextMagic API: %s", string(body))
+		return "", newAPIError(resp, body)
 	}
 
 	var searchResponse struct {
@@ -222,46 +230,101 @@ func (c *clientImpl) findContactByPhone(phone string) (string, error) {
 	return contactID, nil
 }
 
-func (c *clientImpl) SendMessage(contactID, message string) error {
-	sendURL := fmt.Sprintf("%s/messages", c.baseURL)
-
-	// Create payload
+// SendMessage sends a message to a contact and returns the TextMagic message ID
+func (c *clientImpl) SendMessage(ctx context.Context, contactID, message string) (string, error) {
 	payload := map[string]interface{}{
 		"contacts": contactID,
 		"text":     message,
 	}
 
+	messageID, err := c.sendMessage(ctx, payload)
+	if err != nil {
+		return "", err
+	}
+
+	log.Printf("Successfully sent message %s to contact ID: %s", messageID, contactID)
+	return messageID, nil
+}
+
+// SendMessageToPhone sends a message to a number that may not be a saved contact
+func (c *clientImpl) SendMessageToPhone(ctx context.Context, phone, message string) (string, error) {
+	number, err := normalizePhone(phone)
+	if err != nil {
+		return "", err
+	}
+
+	payload := map[string]interface{}{
+		"phones": number,
+		"text":   message,
+	}
+
+	messageID, err := c.sendMessage(ctx, payload)
+	if err != nil {
+		return "", err
+	}
+
+	log.Printf("Successfully sent message %s to phone: %s", messageID, phone)
+	return messageID, nil
+}
+
+// normalizePhone converts a phone number to the digits-only international format TextMagic uses
+func normalizePhone(raw string) (string, error) {
+	number, err := phone.Normalize(raw)
+	if err != nil {
+		return "", err
+	}
+	return phone.Digits(number), nil
+}
+
+func (c *clientImpl) sendMessage(ctx context.Context, payload map[string]interface{}) (string, error) {
+	sendURL := fmt.Sprintf("%s/messages", c.baseURL)
+
 	jsonPayload, err := json.Marshal(payload)
 	if err != nil {
-		return fmt.Errorf("error creating payload: %w", err)
+		return "", fmt.Errorf("error creating payload: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", sendURL, bytes.NewBuffer(jsonPayload))
+	req, err := http.NewRequestWithContext(ctx, "POST", sendURL, bytes.NewBuffer(jsonPayload))
 	if err != nil {
-		return fmt.Errorf("error creating request: %w", err)
+		return "", fmt.Errorf("error creating request: %w", err)
 	}
 
 	// Add authentication headers
 	req.SetBasicAuth(c.username, c.apiKey)
 	req.Header.Add("Content-Type", "application/json")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	req, wrote := retry.TraceWrite(req)
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("error sending message: %w", err)
+		return "", newUnsentError("sending message", err, wrote())
 	}
 	defer resp.Body.Close()
 
 	// Read response body
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return fmt.Errorf("error reading response: %w", err)
+		return "", fmt.Errorf("error reading response: %w", err)
 	}
 
 	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("error from TextMagic API: %s", string(body))
+		return "", newAPIError(resp, body)
+	}
+
+	// Parse response
+	var sendResponse struct {
+		ID        int `json:"id"`
+		MessageID int `json:"messageId"`
+		SessionID int `json:"sessionId"`
 	}
 
-	log.Printf("Successfully sent message to contact ID: %s", contactID)
-	return nil
+	if err := json.Unmarshal(body, &sendResponse); err != nil {
+		return "", fmt.Errorf("error parsing response: %w", err)
+	}
+
+	// Single-recipient sends report the message ID; fall back to the resource ID
+	messageID := sendResponse.MessageID
+	if messageID == 0 {
+		messageID = sendResponse.ID
+	}
+	return fmt.Sprintf("%d", messageID), nil
 }
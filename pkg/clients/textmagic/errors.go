@@ -0,0 +1,92 @@
+package textmagic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"sample-golang/pkg/retry"
+)
+
+// APIError describes a failed call to the TextMagic API
+type APIError struct {
+	StatusCode int
+	Code       string
+	Message    string
+	Op         string
+	Err        error
+	retryAfter time.Duration
+	// unsent is set when the request is known not to have been written
+	unsent bool
+}
+
+func (e *APIError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("error %s: %v", e.Op, e.Err)
+	}
+	if e.Code != "" {
+		return fmt.Sprintf("error from TextMagic API (status %d, code %s): %s", e.StatusCode, e.Code, e.Message)
+	}
+	return fmt.Sprintf("error from TextMagic API (status %d): %s", e.StatusCode, e.Message)
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable reports whether the request failed for a transient reason
+func (e *APIError) Retryable() bool {
+	if e.Err != nil {
+		// A cancelled caller should not be retried, but a timed-out attempt can be
+		return !errors.Is(e.Err, context.Canceled)
+	}
+	return retry.IsRetryableStatus(e.StatusCode)
+}
+
+// Replayable reports whether a request that isn't safe to repeat can be retried
+// because TextMagic never received it or turned it away without processing it
+func (e *APIError) Replayable() bool {
+	if e.Err != nil {
+		return e.unsent && !errors.Is(e.Err, context.Canceled)
+	}
+	return retry.IsUnprocessedStatus(e.StatusCode)
+}
+
+// RetryAfter returns the delay requested by the Retry-After header, if any
+func (e *APIError) RetryAfter() time.Duration {
+	return e.retryAfter
+}
+
+// newTransportError wraps a failure to reach the TextMagic API
+func newTransportError(op string, err error) *APIError {
+	return &APIError{Op: op, Err: err}
+}
+
+// newUnsentError wraps a failure to reach the TextMagic API, recording whether
+// the request was written before it failed
+func newUnsentError(op string, err error, wrote bool) *APIError {
+	return &APIError{Op: op, Err: err, unsent: !wrote}
+}
+
+// newAPIError classifies a non-successful TextMagic response
+func newAPIError(resp *http.Response, body []byte) *APIError {
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		Message:    string(body),
+		retryAfter: retry.ParseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+
+	// TextMagic errors look like {"code": 400, "message": "..."}
+	var errorResponse struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &errorResponse); err == nil && errorResponse.Message != "" {
+		apiErr.Code = fmt.Sprintf("%d", errorResponse.Code)
+		apiErr.Message = errorResponse.Message
+	}
+	return apiErr
+}
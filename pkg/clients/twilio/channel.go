@@ -0,0 +1,57 @@
+package twilio
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+
+	"sample-golang/pkg/phone"
+)
+
+// Channel is how a verification code is delivered
+type Channel string
+
+const (
+	ChannelSMS      Channel = "sms"
+	ChannelCall     Channel = "call"
+	ChannelWhatsApp Channel = "whatsapp"
+	ChannelEmail    Channel = "email"
+)
+
+var (
+	ErrUnsupportedChannel = errors.New("unsupported verification channel")
+	ErrInvalidDestination = errors.New("invalid verification destination")
+)
+
+// ParseChannel converts a channel name from a request into a Channel
+func ParseChannel(name string) (Channel, error) {
+	switch channel := Channel(name); channel {
+	case ChannelSMS, ChannelCall, ChannelWhatsApp, ChannelEmail:
+		return channel, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrUnsupportedChannel, name)
+	}
+}
+
+// ReachesPhone reports whether receiving a code on the channel shows control of
+// the phone number; an email address says nothing about who holds the phone
+func (ch Channel) ReachesPhone() bool {
+	return ch != ChannelEmail
+}
+
+// Validate checks that destination can receive codes on the channel: an email
+// address for email, and an E.164 phone number for everything else
+func (ch Channel) Validate(destination string) error {
+	if ch == ChannelEmail {
+		addr, err := mail.ParseAddress(destination)
+		if err != nil || addr.Address != destination {
+			return fmt.Errorf("%w: %s needs an email address", ErrInvalidDestination, ch)
+		}
+		return nil
+	}
+
+	if number, err := phone.Parse(destination, ""); err != nil || number != destination {
+		return fmt.Errorf("%w: %s needs an E.164 phone number", ErrInvalidDestination, ch)
+	}
+	return nil
+}
@@ -1,17 +1,22 @@
 package twilio
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/twilio/twilio-go"
 	verify "github.com/twilio/twilio-go/rest/verify/v2"
 )
 
+// requestTimeout bounds a single HTTP request to the Twilio API
+const requestTimeout = 15 * time.Second
+
 // Client defines the interface for interacting with Twilio Verify API
 type Client interface {
-	SendVerificationCode(phoneNumber string) error
-	CheckVerificationCode(phoneNumber, code string) (bool, error)
+	SendVerificationCode(ctx context.Context, to string, channel Channel) error
+	CheckVerificationCode(ctx context.Context, to, code string) (bool, error)
 }
 
 type clientImpl struct {
@@ -25,6 +30,7 @@ func NewClient(accountSid, authToken, serviceID string) Client {
 		Username: accountSid,
 		Password: authToken,
 	})
+	client.SetTimeout(requestTimeout)
 
 	return &clientImpl{
 		client:    client,
@@ -32,31 +38,65 @@ func NewClient(accountSid, authToken, serviceID string) Client {
 	}
 }
 
-func (c *clientImpl) SendVerificationCode(phoneNumber string) error {
+func (c *clientImpl) SendVerificationCode(ctx context.Context, to string, channel Channel) error {
+	if err := channel.Validate(to); err != nil {
+		return err
+	}
+
 	params := &verify.CreateVerificationParams{}
-	params.SetTo(phoneNumber)
-	params.SetChannel("sms")
+	params.SetTo(to)
+	params.SetChannel(string(channel))
 
-	resp, err := c.client.VerifyV2.CreateVerification(c.serviceID, params)
+	var resp *verify.VerifyV2Verification
+	err := withContext(ctx, func() error {
+		var err error
+		resp, err = c.client.VerifyV2.CreateVerification(c.serviceID, params)
+		return err
+	})
 	if err != nil {
-		return fmt.Errorf("error sending verification code: %w", err)
+		return fmt.Errorf("error sending verification code by %s: %w", channel, err)
 	}
 
-	log.Printf("Sent verification code to: %s, status: %s", phoneNumber, *resp.Status)
+	log.Printf("Sent verification code by %s to: %s, status: %s", channel, to, *resp.Status)
 	return nil
 }
 
-func (c *clientImpl) CheckVerificationCode(phoneNumber, code string) (bool, error) {
+func (c *clientImpl) CheckVerificationCode(ctx context.Context, to, code string) (bool, error) {
 	params := &verify.CreateVerificationCheckParams{}
-	params.SetTo(phoneNumber)
+	params.SetTo(to)
 	params.SetCode(code)
 
-	resp, err := c.client.VerifyV2.CreateVerificationCheck(c.serviceID, params)
+	var resp *verify.VerifyV2VerificationCheck
+	err := withContext(ctx, func() error {
+		var err error
+		resp, err = c.client.VerifyV2.CreateVerificationCheck(c.serviceID, params)
+		return err
+	})
 	if err != nil {
 		return false, fmt.Errorf("error checking verification code: %w", err)
 	}
 
 	verified := *resp.Status == "approved"
-	log.Printf("Verification check for %s: %v", phoneNumber, verified)
+	log.Printf("Verification check for %s: %v", to, verified)
 	return verified, nil
 }
+
+// withContext runs fn but returns early if ctx is done. The Twilio SDK does not
+// accept a context, so the request itself is only bounded by requestTimeout.
+func withContext(ctx context.Context, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
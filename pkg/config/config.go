@@ -2,6 +2,8 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"strings"
 )
 
 // Config holds all application configuration values
@@ -12,8 +14,60 @@ type Config struct {
 	AirtableBaseID       string
 	AirtablePartialTable string
 	AirtableR2ETable     string
+	AirtableRate         float64
 	ShortIOAPIKey        string
 	ShortIODomain        string
+	TwilioAccountSID     string
+	TwilioAuthToken      string
+	TwilioVerifyService  string
+	RequireVerification  bool
+	DatabaseURL          string
+	Store                string
+	DataDir              string
+	SubmissionWorkers    int
+	SubmissionQueueSize  int
+	QueueRetryAfter      int
+	ShutdownTimeout      int
+	LandingSecrets       []string
+	LandingTokens        []string
+	WebhookReplayWindow  int
+	WebhookAuthDisabled  bool
+	RedisAddr            string
+	RedisPassword        string
+	TrustedProxies       []string
+	ClientIPHeader       string
+	LandingIPLimit       string
+	LandingPhoneLimit    string
+	VerifyIPLimit        string
+	VerifyPhoneLimit     string
+	VerificationStore    string
+	VerifyMaxAttempts    int
+	VerifyMaxSends       int
+	VerifyResendCooldown int
+	VerifyLockout        int
+	VerifyProvider       string
+	OTPCodeLength        int
+	OTPTTL               int
+	PhoneRegion          string
+	PhoneHashKeys        []string
+	PhoneHashLegacy      bool
+	TokenSecrets         []string
+	TokenTTL             int
+	TokenLegacyID        bool
+	CampaignsFile        string
+	SequencesFile        string
+	TemplatesFile        string
+	SMSMaxSegments       int
+	SendWindowStart      string
+	SendWindowEnd        string
+	SendWindowTimezone   string
+	TextMagicTokens      []string
+	AdminAPIKeys         []string
+	FilloutSecrets       []string
+	FilloutTokens        []string
+	FilloutWriteR2E      bool
+	AirtableWebhookURL   string
+	AirtableR2EHashField string
 }
 
 // LoadConfig reads configuration from environment variables
@@ -25,7 +79,96 @@ func LoadConfig() *Config {
 		AirtableBaseID:       os.Getenv("AIRTABLE_BASE_ID"),
 		AirtablePartialTable: os.Getenv("AIRTABLE_PARTIAL_TABLE"),
 		AirtableR2ETable:     os.Getenv("AIRTABLE_R2E_TABLE"),
+		AirtableRate:         getEnvFloat("AIRTABLE_REQUESTS_PER_SECOND", 5),
 		ShortIOAPIKey:        os.Getenv("SHORTIO_API_KEY"),
 		ShortIODomain:        os.Getenv("SHORTIO_DOMAIN"),
+		TwilioAccountSID:     os.Getenv("TWILIO_ACCOUNT_SID"),
+		TwilioAuthToken:      os.Getenv("TWILIO_AUTH_TOKEN"),
+		TwilioVerifyService:  os.Getenv("TWILIO_VERIFY_SERVICE_ID"),
+		RequireVerification:  os.Getenv("REQUIRE_PHONE_VERIFICATION") == "true",
+		DatabaseURL:          os.Getenv("DATABASE_URL"),
+		Store:                getEnv("STORE", "sql"),
+		DataDir:              getEnv("DATA_DIR", "data"),
+		SubmissionWorkers:    getEnvInt("SUBMISSION_WORKERS", 4),
+		SubmissionQueueSize:  getEnvInt("SUBMISSION_QUEUE_SIZE", 500),
+		QueueRetryAfter:      getEnvInt("QUEUE_RETRY_AFTER_SECONDS", 30),
+		ShutdownTimeout:      getEnvInt("SHUTDOWN_TIMEOUT_SECONDS", 25),
+		LandingSecrets:       getEnvList("LANDING_WEBHOOK_SECRETS"),
+		LandingTokens:        getEnvList("LANDING_WEBHOOK_TOKENS"),
+		WebhookReplayWindow:  getEnvInt("WEBHOOK_REPLAY_WINDOW_SECONDS", 300),
+		WebhookAuthDisabled:  os.Getenv("WEBHOOK_AUTH_DISABLED") == "true",
+		RedisAddr:            os.Getenv("REDIS_ADDR"),
+		RedisPassword:        os.Getenv("REDIS_PASSWORD"),
+		TrustedProxies:       getEnvList("TRUSTED_PROXIES"),
+		ClientIPHeader:       os.Getenv("CLIENT_IP_HEADER"),
+		LandingIPLimit:       getEnv("RATE_LIMIT_LANDING_IP", "120/1m"),
+		LandingPhoneLimit:    getEnv("RATE_LIMIT_LANDING_PHONE", "3/1h"),
+		VerifyIPLimit:        getEnv("RATE_LIMIT_VERIFICATION_IP", "20/1m"),
+		VerifyPhoneLimit:     getEnv("RATE_LIMIT_VERIFICATION_PHONE", "10/1h"),
+		VerificationStore:    getEnv("VERIFICATION_STORE", "memory"),
+		VerifyMaxAttempts:    getEnvInt("VERIFICATION_MAX_ATTEMPTS", 5),
+		VerifyMaxSends:       getEnvInt("VERIFICATION_MAX_SENDS", 5),
+		VerifyResendCooldown: getEnvInt("VERIFICATION_RESEND_COOLDOWN_SECONDS", 30),
+		VerifyLockout:        getEnvInt("VERIFICATION_LOCKOUT_SECONDS", 1800),
+		VerifyProvider:       getEnv("VERIFICATION_PROVIDER", "twilio"),
+		OTPCodeLength:        getEnvInt("OTP_CODE_LENGTH", 6),
+		OTPTTL:               getEnvInt("OTP_TTL_SECONDS", 600),
+		PhoneRegion:          getEnv("PHONE_DEFAULT_REGION", "US"),
+		PhoneHashKeys:        getEnvList("PHONE_HASH_KEYS"),
+		PhoneHashLegacy:      os.Getenv("PHONE_HASH_LEGACY") == "true",
+		TokenSecrets:         getEnvList("LINK_TOKEN_SECRETS"),
+		TokenTTL:             getEnvInt("LINK_TOKEN_TTL_HOURS", 72),
+		TokenLegacyID:        os.Getenv("LINK_LEGACY_ID") == "true",
+		CampaignsFile:        os.Getenv("CAMPAIGNS_FILE"),
+		SequencesFile:        os.Getenv("SEQUENCES_FILE"),
+		TemplatesFile:        os.Getenv("TEMPLATES_FILE"),
+		SMSMaxSegments:       getEnvInt("SMS_MAX_SEGMENTS", 1),
+		SendWindowStart:      getEnv("SEND_WINDOW_START", "09:00"),
+		SendWindowEnd:        getEnv("SEND_WINDOW_END", "20:00"),
+		SendWindowTimezone:   getEnv("SEND_WINDOW_TIMEZONE", "America/New_York"),
+		TextMagicTokens:      getEnvList("TEXTMAGIC_WEBHOOK_TOKENS"),
+		AdminAPIKeys:         getEnvList("ADMIN_API_KEYS"),
+		FilloutSecrets:       getEnvList("FILLOUT_WEBHOOK_SECRETS"),
+		FilloutTokens:        getEnvList("FILLOUT_WEBHOOK_TOKENS"),
+		FilloutWriteR2E:      os.Getenv("FILLOUT_WRITE_R2E") == "true",
+		AirtableWebhookURL:   os.Getenv("AIRTABLE_WEBHOOK_URL"),
+		AirtableR2EHashField: getEnv("AIRTABLE_R2E_HASH_FIELD", "hash"),
 	}
 }
+
+// getEnv returns the value of an environment variable or a fallback if unset
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// getEnvInt returns an integer environment variable or a fallback if unset or invalid
+func getEnvInt(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// getEnvFloat returns a decimal environment variable or a fallback if unset or invalid
+func getEnvFloat(key string, fallback float64) float64 {
+	value, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// getEnvList splits a comma-separated environment variable, dropping empty entries
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
@@ -0,0 +1,63 @@
+package consent
+
+import (
+	"errors"
+	"time"
+
+	"sample-golang/pkg/docstore"
+)
+
+// Record holds the messaging consent state for a phone hash
+type Record struct {
+	OptedOut  bool      `json:"opted_out"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Store defines the interface for persisting SMS opt-out state
+type Store interface {
+	SetOptedOut(phoneHash string, optedOut bool) error
+	// IsOptedOut reports whether the phone opted out under any of its hashes
+	IsOptedOut(phoneHashes ...string) (bool, error)
+	Delete(phoneHash string) error
+	List() (map[string]Record, error)
+}
+
+type storeImpl struct {
+	records docstore.Collection[Record]
+}
+
+// NewStore creates a store that keeps consent records in the "consent" collection
+func NewStore(backend docstore.Backend) Store {
+	return &storeImpl{records: docstore.NewCollection[Record](backend, "consent")}
+}
+
+func (s *storeImpl) SetOptedOut(phoneHash string, optedOut bool) error {
+	return s.records.Put(phoneHash, Record{
+		OptedOut:  optedOut,
+		UpdatedAt: time.Now(),
+	})
+}
+
+func (s *storeImpl) IsOptedOut(phoneHashes ...string) (bool, error) {
+	for _, phoneHash := range phoneHashes {
+		record, err := s.records.Get(phoneHash)
+		if errors.Is(err, docstore.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		if record.OptedOut {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *storeImpl) Delete(phoneHash string) error {
+	return s.records.Delete(phoneHash)
+}
+
+func (s *storeImpl) List() (map[string]Record, error) {
+	return s.records.List("")
+}
@@ -0,0 +1,59 @@
+// Package database opens the SQL database that shared state is kept in. The
+// stores built on it use numbered placeholders and integer timestamps so the
+// same queries run on Postgres and SQLite.
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	_ "github.com/lib/pq"  // Registers the "postgres" driver
+	_ "modernc.org/sqlite" // Registers the "sqlite" driver
+)
+
+// sqlitePrefix marks a URL as a SQLite database file, e.g. "sqlite:data/app.db"
+const sqlitePrefix = "sqlite:"
+
+// Open connects to the database at url. URLs starting with "sqlite:" open a
+// local SQLite file, which suits a single instance; anything else is passed to
+// the Postgres driver.
+func Open(url string) (*sql.DB, error) {
+	if url == "" {
+		return nil, errors.New("database URL is empty")
+	}
+
+	driver, dsn := "postgres", url
+	if strings.HasPrefix(url, sqlitePrefix) {
+		driver, dsn = "sqlite", sqliteDSN(strings.TrimPrefix(url, sqlitePrefix))
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite allows one writer at a time; sharing a single connection queues
+	// writes in the pool instead of failing them with "database is locked"
+	if driver == "sqlite" {
+		db.SetMaxOpenConns(1)
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// sqliteDSN adds the pragmas the stores rely on unless the URL sets its own
+func sqliteDSN(path string) string {
+	if strings.Contains(path, "_pragma=") {
+		return path
+	}
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return path + sep + "_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+}
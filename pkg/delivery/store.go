@@ -0,0 +1,90 @@
+package delivery
+
+import (
+	"errors"
+	"time"
+
+	"sample-golang/pkg/docstore"
+)
+
+// Status is a stage in an outgoing message's lifecycle
+type Status string
+
+const (
+	StatusQueued    Status = "queued"
+	StatusSent      Status = "sent"
+	StatusDelivered Status = "delivered"
+	StatusFailed    Status = "failed"
+	StatusUnknown   Status = "unknown"
+)
+
+// ErrMessageNotFound is returned when no message is stored under an ID
+var ErrMessageNotFound = errors.New("message not found")
+
+// Event records a single status change reported for a message
+type Event struct {
+	Status    Status    `json:"status"`
+	ErrorCode string    `json:"error_code,omitempty"`
+	At        time.Time `json:"at"`
+}
+
+// Message tracks an SMS we sent and what happened to it
+type Message struct {
+	ID        string    `json:"id"`
+	PhoneHash string    `json:"phone_hash"`
+	Kind      string    `json:"kind"`
+	Status    Status    `json:"status"`
+	ErrorCode string    `json:"error_code,omitempty"`
+	History   []Event   `json:"history"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Store defines the interface for persisting message delivery state
+type Store interface {
+	// Update applies fn to the message stored under id, or to a new message if
+	// there is none, and saves the result. Concurrent updates don't overwrite each other.
+	Update(id string, fn func(msg *Message, exists bool)) error
+	Get(id string) (Message, error)
+	List(status Status) ([]Message, error)
+}
+
+type storeImpl struct {
+	messages docstore.Collection[Message]
+}
+
+// NewStore creates a store that keeps message records in the "messages" collection
+func NewStore(backend docstore.Backend) Store {
+	return &storeImpl{messages: docstore.NewCollection[Message](backend, "messages")}
+}
+
+func (s *storeImpl) Update(id string, fn func(msg *Message, exists bool)) error {
+	return s.messages.Update(id, func(msg *Message, exists bool) (bool, error) {
+		fn(msg, exists)
+		return true, nil
+	})
+}
+
+func (s *storeImpl) Get(id string) (Message, error) {
+	msg, err := s.messages.Get(id)
+	if errors.Is(err, docstore.ErrNotFound) {
+		return Message{}, ErrMessageNotFound
+	}
+	return msg, err
+}
+
+// List returns messages with the given status, or all messages if status is empty
+func (s *storeImpl) List(status Status) ([]Message, error) {
+	messages, err := s.messages.List("")
+	if err != nil {
+		return nil, err
+	}
+
+	result := []Message{}
+	for _, msg := range messages {
+		if status == "" || msg.Status == status {
+			result = append(result, msg)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,115 @@
+// Package docstore keeps JSON documents by key, in files on disk for local
+// development or in a SQL table shared by every instance.
+package docstore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrNotFound is returned when a collection has no document under a key
+var ErrNotFound = errors.New("document not found")
+
+// Backend stores raw JSON documents grouped into named collections
+type Backend interface {
+	// Get returns ErrNotFound if the collection has no document under key
+	Get(collection, key string) ([]byte, error)
+	// Update replaces the document under key with what fn returns for its
+	// current value, which is nil if there is none. If fn returns nil the
+	// document is left alone. fn may run more than once when another writer
+	// changes the document at the same time.
+	Update(collection, key string, fn func(current []byte) ([]byte, error)) error
+	Delete(collection, key string) error
+	// List returns the documents whose keys start with prefix
+	List(collection, prefix string) (map[string][]byte, error)
+}
+
+// Collection is a typed view of one collection in a backend
+type Collection[T any] interface {
+	// Get returns ErrNotFound if there is no document under key
+	Get(key string) (T, error)
+	Put(key string, doc T) error
+	// Update calls fn with the current document, or the zero value and false
+	// if there is none, and saves it if fn returns true. Concurrent updates
+	// to the same key don't overwrite each other.
+	Update(key string, fn func(doc *T, exists bool) (bool, error)) error
+	Delete(key string) error
+	// List returns the documents whose keys start with prefix
+	List(prefix string) (map[string]T, error)
+}
+
+type collectionImpl[T any] struct {
+	backend Backend
+	name    string
+}
+
+// NewCollection returns the collection called name in backend
+func NewCollection[T any](backend Backend, name string) Collection[T] {
+	return &collectionImpl[T]{backend: backend, name: name}
+}
+
+func (c *collectionImpl[T]) Get(key string) (T, error) {
+	var doc T
+	data, err := c.backend.Get(c.name, key)
+	if err != nil {
+		return doc, err
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return doc, fmt.Errorf("error parsing %s document %s: %w", c.name, key, err)
+	}
+	return doc, nil
+}
+
+func (c *collectionImpl[T]) Put(key string, doc T) error {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("error encoding %s document %s: %w", c.name, key, err)
+	}
+	return c.backend.Update(c.name, key, func([]byte) ([]byte, error) {
+		return data, nil
+	})
+}
+
+func (c *collectionImpl[T]) Update(key string, fn func(doc *T, exists bool) (bool, error)) error {
+	return c.backend.Update(c.name, key, func(current []byte) ([]byte, error) {
+		var doc T
+		if current != nil {
+			if err := json.Unmarshal(current, &doc); err != nil {
+				return nil, fmt.Errorf("error parsing %s document %s: %w", c.name, key, err)
+			}
+		}
+
+		save, err := fn(&doc, current != nil)
+		if err != nil || !save {
+			return nil, err
+		}
+
+		data, err := json.Marshal(doc)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding %s document %s: %w", c.name, key, err)
+		}
+		return data, nil
+	})
+}
+
+func (c *collectionImpl[T]) Delete(key string) error {
+	return c.backend.Delete(c.name, key)
+}
+
+func (c *collectionImpl[T]) List(prefix string) (map[string]T, error) {
+	raw, err := c.backend.List(c.name, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	docs := make(map[string]T, len(raw))
+	for key, data := range raw {
+		var doc T
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("error parsing %s document %s: %w", c.name, key, err)
+		}
+		docs[key] = doc
+	}
+	return docs, nil
+}
@@ -0,0 +1,132 @@
+package docstore
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"sample-golang/pkg/database"
+)
+
+type counter struct {
+	Count int `json:"count"`
+}
+
+// backends returns a fresh instance of each backend to run a test against
+func backends(t *testing.T) map[string]Backend {
+	t.Helper()
+	file, err := NewFileBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileBackend: %v", err)
+	}
+
+	db, err := database.Open("sqlite:" + filepath.Join(t.TempDir(), "documents.db"))
+	if err != nil {
+		t.Fatalf("database.Open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	sqlite, err := NewSQLBackend(db)
+	if err != nil {
+		t.Fatalf("NewSQLBackend: %v", err)
+	}
+
+	return map[string]Backend{"file": file, "sqlite": sqlite}
+}
+
+// forEachBackend runs test against a collection on each backend
+func forEachBackend(t *testing.T, test func(t *testing.T, docs Collection[counter])) {
+	for name, backend := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			test(t, NewCollection[counter](backend, "counters"))
+		})
+	}
+}
+
+func TestGetMissing(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, docs Collection[counter]) {
+		_, err := docs.Get("missing")
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestUpdate(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, docs Collection[counter]) {
+
+		increment := func(doc *counter, exists bool) (bool, error) {
+			doc.Count++
+			return true, nil
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := docs.Update("hits", increment); err != nil {
+					t.Errorf("Update: %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		got, err := docs.Get("hits")
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		if got.Count != 20 {
+			t.Errorf("Count = %d, want 20", got.Count)
+		}
+
+		// Returning false leaves the document alone
+		err = docs.Update("hits", func(doc *counter, exists bool) (bool, error) {
+			doc.Count = 0
+			return false, nil
+		})
+		if err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+		if got, _ := docs.Get("hits"); got.Count != 20 {
+			t.Errorf("Count = %d after an update that didn't save, want 20", got.Count)
+		}
+	})
+}
+
+func TestList(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, docs Collection[counter]) {
+		for key, count := range map[string]int{"a/1": 1, "a/2": 2, "b/1": 3} {
+			if err := docs.Put(key, counter{Count: count}); err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+		}
+
+		tests := []struct {
+			prefix string
+			want   int
+		}{
+			{"", 3},
+			{"a/", 2},
+			{"b/1", 1},
+			{"c/", 0},
+		}
+
+		for _, tt := range tests {
+			got, err := docs.List(tt.prefix)
+			if err != nil {
+				t.Fatalf("List(%q): %v", tt.prefix, err)
+			}
+			if len(got) != tt.want {
+				t.Errorf("List(%q) returned %d documents, want %d", tt.prefix, len(got), tt.want)
+			}
+		}
+
+		if err := docs.Delete("a/1"); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		if _, err := docs.Get("a/1"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get after Delete = %v, want ErrNotFound", err)
+		}
+	})
+}
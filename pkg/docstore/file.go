@@ -0,0 +1,142 @@
+package docstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+type fileBackend struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewFileBackend creates a backend that keeps each collection in a JSON file
+// in dir. The files aren't shared between instances, so it is only suited to
+// local development.
+func NewFileBackend(dir string) (Backend, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating store directory: %w", err)
+	}
+	return &fileBackend{dir: dir}, nil
+}
+
+func (b *fileBackend) Get(collection, key string) ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	docs, err := b.load(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	data, ok := docs[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return data, nil
+}
+
+func (b *fileBackend) Update(collection, key string, fn func(current []byte) ([]byte, error)) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	docs, err := b.load(collection)
+	if err != nil {
+		return err
+	}
+
+	var current []byte
+	if data, ok := docs[key]; ok {
+		current = data
+	}
+
+	next, err := fn(current)
+	if err != nil || next == nil {
+		return err
+	}
+
+	docs[key] = next
+	return b.write(collection, docs)
+}
+
+func (b *fileBackend) Delete(collection, key string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	docs, err := b.load(collection)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := docs[key]; !ok {
+		return nil
+	}
+	delete(docs, key)
+	return b.write(collection, docs)
+}
+
+func (b *fileBackend) List(collection, prefix string) (map[string][]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	docs, err := b.load(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string][]byte)
+	for key, data := range docs {
+		if strings.HasPrefix(key, prefix) {
+			result[key] = data
+		}
+	}
+	return result, nil
+}
+
+func (b *fileBackend) path(collection string) string {
+	return filepath.Join(b.dir, collection+".json")
+}
+
+func (b *fileBackend) load(collection string) (map[string]json.RawMessage, error) {
+	docs := make(map[string]json.RawMessage)
+
+	data, err := os.ReadFile(b.path(collection))
+	if os.IsNotExist(err) {
+		return docs, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s store: %w", collection, err)
+	}
+
+	if len(data) == 0 {
+		return docs, nil
+	}
+
+	if err := json.Unmarshal(data, &docs); err != nil {
+		return nil, fmt.Errorf("error parsing %s store: %w", collection, err)
+	}
+	return docs, nil
+}
+
+// write replaces the collection's file atomically so a crash never leaves it half-written
+func (b *fileBackend) write(collection string, docs map[string]json.RawMessage) error {
+	data, err := json.MarshalIndent(docs, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding %s store: %w", collection, err)
+	}
+
+	path := b.path(collection)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("error writing %s store: %w", collection, err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("error replacing %s store: %w", collection, err)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package docstore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// maxUpdateAttempts bounds how often Update retries after losing a race
+const maxUpdateAttempts = 10
+
+type sqlBackend struct {
+	db *sql.DB
+}
+
+// NewSQLBackend creates a backend that keeps every collection in one table of
+// a SQL database shared by all instances. Like the scheduler's store, it uses
+// numbered placeholders so it runs on Postgres and SQLite; open the database
+// with the database package, which registers both drivers.
+func NewSQLBackend(db *sql.DB) (Backend, error) {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS documents (
+		collection TEXT NOT NULL,
+		doc_key TEXT NOT NULL,
+		body TEXT NOT NULL,
+		version BIGINT NOT NULL,
+		updated_at BIGINT NOT NULL,
+		PRIMARY KEY (collection, doc_key)
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("error creating documents table: %w", err)
+	}
+
+	return &sqlBackend{db: db}, nil
+}
+
+func (b *sqlBackend) Get(collection, key string) ([]byte, error) {
+	data, _, err := b.get(collection, key)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, ErrNotFound
+	}
+	return data, nil
+}
+
+// get returns the document and its version, or nil and 0 if there is none
+func (b *sqlBackend) get(collection, key string) ([]byte, int64, error) {
+	var body string
+	var version int64
+	err := b.db.QueryRow(
+		`SELECT body, version FROM documents WHERE collection = $1 AND doc_key = $2`,
+		collection, key,
+	).Scan(&body, &version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("error reading %s document: %w", collection, err)
+	}
+	return []byte(body), version, nil
+}
+
+// Update writes only if the document's version is unchanged since it was
+// read, and starts over with the newer document if it isn't
+func (b *sqlBackend) Update(collection, key string, fn func(current []byte) ([]byte, error)) error {
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		current, version, err := b.get(collection, key)
+		if err != nil {
+			return err
+		}
+
+		next, err := fn(current)
+		if err != nil || next == nil {
+			return err
+		}
+
+		var res sql.Result
+		now := time.Now().Unix()
+		if current == nil {
+			res, err = b.db.Exec(
+				`INSERT INTO documents (collection, doc_key, body, version, updated_at) VALUES ($1, $2, $3, 1, $4) ON CONFLICT (collection, doc_key) DO NOTHING`,
+				collection, key, string(next), now,
+			)
+		} else {
+			res, err = b.db.Exec(
+				`UPDATE documents SET body = $3, version = version + 1, updated_at = $4 WHERE collection = $1 AND doc_key = $2 AND version = $5`,
+				collection, key, string(next), now, version,
+			)
+		}
+		if err != nil {
+			return fmt.Errorf("error writing %s document: %w", collection, err)
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("error writing %s document: %w", collection, err)
+		}
+		if n == 1 {
+			return nil
+		}
+	}
+	return fmt.Errorf("error writing %s document %s: too many concurrent updates", collection, key)
+}
+
+func (b *sqlBackend) Delete(collection, key string) error {
+	if _, err := b.db.Exec(`DELETE FROM documents WHERE collection = $1 AND doc_key = $2`, collection, key); err != nil {
+		return fmt.Errorf("error deleting %s document: %w", collection, err)
+	}
+	return nil
+}
+
+// likeEscaper stops LIKE treating characters in a prefix as wildcards
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func (b *sqlBackend) List(collection, prefix string) (map[string][]byte, error) {
+	rows, err := b.db.Query(
+		`SELECT doc_key, body FROM documents WHERE collection = $1 AND doc_key LIKE $2 ESCAPE '\'`,
+		collection, likeEscaper.Replace(prefix)+"%",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error listing %s documents: %w", collection, err)
+	}
+	defer rows.Close()
+
+	docs := make(map[string][]byte)
+	for rows.Next() {
+		var key, body string
+		if err := rows.Scan(&key, &body); err != nil {
+			return nil, fmt.Errorf("error scanning %s document: %w", collection, err)
+		}
+		docs[key] = []byte(body)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error listing %s documents: %w", collection, err)
+	}
+	return docs, nil
+}
@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"sample-golang/pkg/resp"
+)
+
+// ReplayStore remembers the signatures of accepted webhook requests so a
+// signed request is only accepted once. It is shared by every instance unless
+// it keeps signatures in process memory.
+type ReplayStore interface {
+	// Add records a signature for ttl and reports whether it was new
+	Add(signature string, ttl time.Duration) (bool, error)
+}
+
+type memoryReplayStore struct {
+	seen map[string]time.Time
+	mu   sync.Mutex
+}
+
+// NewMemoryReplayStore creates a store that keeps signatures in process
+// memory, which only stops replays to the same instance
+func NewMemoryReplayStore() ReplayStore {
+	return &memoryReplayStore{seen: make(map[string]time.Time)}
+}
+
+func (s *memoryReplayStore) Add(signature string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for sig, expiresAt := range s.seen {
+		if now.After(expiresAt) {
+			delete(s.seen, sig)
+		}
+	}
+
+	if _, ok := s.seen[signature]; ok {
+		return false, nil
+	}
+	s.seen[signature] = now.Add(ttl)
+	return true, nil
+}
+
+type sqlReplayStore struct {
+	db *sql.DB
+}
+
+// NewSQLReplayStore creates a store backed by Postgres or SQLite, opened with
+// the database package
+func NewSQLReplayStore(db *sql.DB) (ReplayStore, error) {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS webhook_signatures (
+		signature TEXT PRIMARY KEY,
+		expires_at BIGINT NOT NULL
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("error creating webhook_signatures table: %w", err)
+	}
+	return &sqlReplayStore{db: db}, nil
+}
+
+func (s *sqlReplayStore) Add(signature string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	if _, err := s.db.Exec(`DELETE FROM webhook_signatures WHERE expires_at < $1`, now.Unix()); err != nil {
+		return false, fmt.Errorf("error deleting expired signatures: %w", err)
+	}
+
+	// The insert only takes the place of a signature that has expired, so
+	// concurrent requests with the same signature can't both succeed
+	res, err := s.db.Exec(
+		`INSERT INTO webhook_signatures (signature, expires_at) VALUES ($1, $2)
+		ON CONFLICT (signature) DO UPDATE SET expires_at = excluded.expires_at
+		WHERE webhook_signatures.expires_at < $3`,
+		signature, now.Add(ttl).Unix(), now.Unix(),
+	)
+	if err != nil {
+		return false, fmt.Errorf("error saving signature: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error saving signature: %w", err)
+	}
+	return n == 1, nil
+}
+
+type redisReplayStore struct {
+	client resp.Client
+	prefix string
+}
+
+// NewRedisReplayStore creates a store on a Redis-protocol server, which expires
+// signatures on its own
+func NewRedisReplayStore(client resp.Client, prefix string) ReplayStore {
+	return &redisReplayStore{
+		client: client,
+		prefix: prefix,
+	}
+}
+
+func (s *redisReplayStore) Add(signature string, ttl time.Duration) (bool, error) {
+	reply, err := s.client.Do("SET", s.prefix+signature, "1", "NX", "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	if err != nil {
+		return false, fmt.Errorf("error saving signature: %w", err)
+	}
+	// SET NX replies with nil when the key already exists
+	return reply != nil, nil
+}
@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"sample-golang/pkg/database"
+	"sample-golang/pkg/resp"
+)
+
+// replayStores returns a fresh instance of each store, the Redis one running
+// against the embedded stand-in
+func replayStores(t *testing.T) map[string]ReplayStore {
+	t.Helper()
+
+	db, err := database.Open("sqlite:" + filepath.Join(t.TempDir(), "replays.db"))
+	if err != nil {
+		t.Fatalf("database.Open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	sqlStore, err := NewSQLReplayStore(db)
+	if err != nil {
+		t.Fatalf("NewSQLReplayStore: %v", err)
+	}
+
+	server := resp.NewServer("")
+	addr, err := server.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	t.Cleanup(func() { server.Close() })
+	client, err := resp.NewClient(addr, "", 4)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	return map[string]ReplayStore{
+		"memory": NewMemoryReplayStore(),
+		"sqlite": sqlStore,
+		"redis":  NewRedisReplayStore(client, "webhook:"),
+	}
+}
+
+func TestReplayStoreAdd(t *testing.T) {
+	for name, store := range replayStores(t) {
+		t.Run(name, func(t *testing.T) {
+			var accepted atomic.Int32
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					fresh, err := store.Add("sha256=abc", time.Minute)
+					if err != nil {
+						t.Errorf("Add: %v", err)
+					}
+					if fresh {
+						accepted.Add(1)
+					}
+				}()
+			}
+			wg.Wait()
+
+			if accepted.Load() != 1 {
+				t.Errorf("accepted the signature %d times, want once", accepted.Load())
+			}
+			if fresh, err := store.Add("sha256=def", time.Minute); err != nil || !fresh {
+				t.Errorf("Add of another signature = %v, %v, want true", fresh, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newTestRouter(cfg WebhookAuthConfig) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/hook", WebhookAuth(cfg), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	return router
+}
+
+func TestWebhookAuth(t *testing.T) {
+	const body = `{"phone":"+15555550100"}`
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	stale := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	cfg := WebhookAuthConfig{
+		Secrets:      []string{"old", "current"},
+		Tokens:       []string{"token"},
+		ReplayWindow: 5 * time.Minute,
+	}
+
+	tests := []struct {
+		name    string
+		cfg     WebhookAuthConfig
+		query   string
+		headers map[string]string
+		want    int
+	}{
+		{
+			name:    "valid signature",
+			cfg:     cfg,
+			headers: map[string]string{TimestampHeader: now, SignatureHeader: SignWebhook("current", now, []byte(body))},
+			want:    http.StatusOK,
+		},
+		{
+			name:    "signature from a rotated secret",
+			cfg:     cfg,
+			headers: map[string]string{TimestampHeader: now, SignatureHeader: SignWebhook("old", now, []byte(body))},
+			want:    http.StatusOK,
+		},
+		{
+			name:    "wrong secret",
+			cfg:     cfg,
+			headers: map[string]string{TimestampHeader: now, SignatureHeader: SignWebhook("wrong", now, []byte(body))},
+			want:    http.StatusUnauthorized,
+		},
+		{
+			name:    "stale timestamp",
+			cfg:     cfg,
+			headers: map[string]string{TimestampHeader: stale, SignatureHeader: SignWebhook("current", stale, []byte(body))},
+			want:    http.StatusUnauthorized,
+		},
+		{
+			name:    "signature over a different body",
+			cfg:     cfg,
+			headers: map[string]string{TimestampHeader: now, SignatureHeader: SignWebhook("current", now, []byte("{}"))},
+			want:    http.StatusUnauthorized,
+		},
+		{
+			name:    "bearer token",
+			cfg:     cfg,
+			headers: map[string]string{"Authorization": "Bearer token"},
+			want:    http.StatusOK,
+		},
+		{
+			name:    "wrong bearer token",
+			cfg:     cfg,
+			headers: map[string]string{"Authorization": "Bearer nope"},
+			want:    http.StatusUnauthorized,
+		},
+		{
+			name:  "token in the query",
+			cfg:   WebhookAuthConfig{Tokens: []string{"token"}, TokenParam: "token"},
+			query: "?token=token",
+			want:  http.StatusOK,
+		},
+		{
+			name:  "query token without a token parameter configured",
+			cfg:   cfg,
+			query: "?token=token",
+			want:  http.StatusUnauthorized,
+		},
+		{
+			name: "no credentials",
+			cfg:  cfg,
+			want: http.StatusUnauthorized,
+		},
+		{
+			name: "nothing configured fails closed",
+			cfg:  WebhookAuthConfig{ReplayWindow: 5 * time.Minute},
+			want: http.StatusUnauthorized,
+		},
+		{
+			name: "explicitly disabled",
+			cfg:  WebhookAuthConfig{Disabled: true},
+			want: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/hook"+tt.query, strings.NewReader(body))
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+
+			rec := httptest.NewRecorder()
+			newTestRouter(tt.cfg).ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebhookAuthRejectsReplay(t *testing.T) {
+	const body = `{}`
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+
+	for name, store := range replayStores(t) {
+		t.Run(name, func(t *testing.T) {
+			// The replay goes to another instance sharing the store
+			cfg := WebhookAuthConfig{Secrets: []string{"secret"}, ReplayWindow: 5 * time.Minute, Replays: store}
+			instances := []*gin.Engine{newTestRouter(cfg), newTestRouter(cfg)}
+
+			for i, want := range []int{http.StatusOK, http.StatusUnauthorized} {
+				req := httptest.NewRequest(http.MethodPost, "/hook", strings.NewReader(body))
+				req.Header.Set(TimestampHeader, now)
+				req.Header.Set(SignatureHeader, SignWebhook("secret", now, []byte(body)))
+
+				rec := httptest.NewRecorder()
+				instances[i].ServeHTTP(rec, req)
+				if rec.Code != want {
+					t.Errorf("request %d: status = %d, want %d", i+1, rec.Code, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package models
+
+// FilloutSubmission represents the webhook Fillout sends when a form is submitted
+type FilloutSubmission struct {
+	FormID     string `json:"formId"`
+	FormName   string `json:"formName"`
+	Submission struct {
+		SubmissionID   string         `json:"submissionId"`
+		SubmissionTime string         `json:"submissionTime"`
+		Questions      []FilloutField `json:"questions"`
+		URLParameters  []FilloutField `json:"urlParameters"`
+	} `json:"submission"`
+}
+
+// FilloutField is a question answer or hidden field in a Fillout submission
+type FilloutField struct {
+	ID    string      `json:"id"`
+	Name  string      `json:"name"`
+	Type  string      `json:"type,omitempty"`
+	Value interface{} `json:"value"`
+}
+
+// URLParameter returns the value of a hidden field, or "" if it wasn't set
+func (s FilloutSubmission) URLParameter(name string) string {
+	for _, field := range s.Submission.URLParameters {
+		if field.Name == name {
+			value, _ := field.Value.(string)
+			return value
+		}
+	}
+	return ""
+}
@@ -2,9 +2,10 @@ package models
 
 // Represents the data structure coming from Landing Page form
 type LandingFormData struct {
-	First string `json:"first" binding:"required"`
-	Last  string `json:"last" binding:"required"`
-	Phone string `json:"phone" binding:"required"`
+	First    string `json:"first" binding:"required"`
+	Last     string `json:"last" binding:"required"`
+	Phone    string `json:"phone" binding:"required"`
+	Campaign string `json:"campaign,omitempty"` // Slug, empty for the default campaign
 }
 
 // HashedLandingFormData represents the processed data after transformations
@@ -13,3 +14,16 @@ type HashedLandingFormData struct {
 	LastName  string `json:"lastname"`
 	ID        string `json:"id"` // Hashed phone number
 }
+
+// VerificationCheckData represents a request to confirm a phone verification code
+type VerificationCheckData struct {
+	Phone string `json:"phone" binding:"required"`
+	Code  string `json:"code" binding:"required"`
+}
+
+// VerificationStartData represents a request to verify a phone before submitting the landing form.
+// Channels are tried in order, e.g. ["sms", "call"].
+type VerificationStartData struct {
+	LandingFormData
+	Channels []string `json:"channels"`
+}
@@ -0,0 +1,19 @@
+package models
+
+// InboundMessage represents the callback TextMagic sends when someone replies to us
+type InboundMessage struct {
+	ID          string `json:"id" form:"id"`
+	Sender      string `json:"sender" form:"sender"`
+	Receiver    string `json:"receiver" form:"receiver"`
+	Text        string `json:"text" form:"text"`
+	MessageTime string `json:"messageTime" form:"messageTime"`
+}
+
+// DeliveryReceipt represents the status callback TextMagic sends for an outgoing message
+type DeliveryReceipt struct {
+	ID         string `json:"id" form:"id"`
+	Receiver   string `json:"receiver" form:"receiver"`
+	Status     string `json:"status" form:"status"`
+	StatusTime string `json:"statusTime" form:"statusTime"`
+	ErrorCode  string `json:"errorCode" form:"errorCode"`
+}
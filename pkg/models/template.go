@@ -0,0 +1,13 @@
+package models
+
+// TemplatePreviewData represents a request to render a message template with sample data.
+// Either Template names a defined template or Text is rendered directly; empty
+// First, Last and Link fall back to sample values.
+type TemplatePreviewData struct {
+	Campaign string `json:"campaign"`
+	Template string `json:"template"`
+	Text     string `json:"text"`
+	First    string `json:"first"`
+	Last     string `json:"last"`
+	Link     string `json:"link"`
+}
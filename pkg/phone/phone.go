@@ -0,0 +1,178 @@
+package phone
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// ErrInvalid is returned for input that isn't a valid phone number
+var ErrInvalid = errors.New("invalid phone number")
+
+// region describes how numbers are dialled nationally in a country
+type region struct {
+	callingCode string
+	trunkPrefix string
+	minLength   int
+	maxLength   int
+	// timeZone is used for the whole country; NANP numbers go by area code instead
+	timeZone string
+}
+
+// regions covers the countries we expect sign-ups from. Numbers in any other
+// country are still accepted in international format.
+var regions = map[string]region{
+	"US": {callingCode: "1", minLength: 10, maxLength: 10},
+	"CA": {callingCode: "1", minLength: 10, maxLength: 10},
+	"MX": {callingCode: "52", minLength: 10, maxLength: 10, timeZone: "America/Mexico_City"},
+	"GB": {callingCode: "44", trunkPrefix: "0", minLength: 9, maxLength: 10, timeZone: "Europe/London"},
+	"IE": {callingCode: "353", trunkPrefix: "0", minLength: 7, maxLength: 9, timeZone: "Europe/Dublin"},
+	"FR": {callingCode: "33", trunkPrefix: "0", minLength: 9, maxLength: 9, timeZone: "Europe/Paris"},
+	"DE": {callingCode: "49", trunkPrefix: "0", minLength: 6, maxLength: 13, timeZone: "Europe/Berlin"},
+	"ES": {callingCode: "34", minLength: 9, maxLength: 9, timeZone: "Europe/Madrid"},
+	"IT": {callingCode: "39", minLength: 6, maxLength: 11, timeZone: "Europe/Rome"},
+	"NL": {callingCode: "31", trunkPrefix: "0", minLength: 9, maxLength: 9, timeZone: "Europe/Amsterdam"},
+	"AU": {callingCode: "61", trunkPrefix: "0", minLength: 9, maxLength: 9, timeZone: "Australia/Sydney"},
+	"NZ": {callingCode: "64", trunkPrefix: "0", minLength: 8, maxLength: 10, timeZone: "Pacific/Auckland"},
+	"IN": {callingCode: "91", trunkPrefix: "0", minLength: 10, maxLength: 10, timeZone: "Asia/Kolkata"},
+}
+
+var (
+	defaultRegion = "US"
+	mu            sync.RWMutex
+)
+
+// SetDefaultRegion sets the region used by Normalize for numbers written without a country code
+func SetDefaultRegion(code string) error {
+	code = strings.ToUpper(code)
+	if _, ok := regions[code]; !ok {
+		return fmt.Errorf("unsupported phone region %q", code)
+	}
+
+	mu.Lock()
+	defaultRegion = code
+	mu.Unlock()
+	return nil
+}
+
+// Normalize parses a phone number in the default region and returns it in E.164 format
+func Normalize(raw string) (string, error) {
+	mu.RLock()
+	code := defaultRegion
+	mu.RUnlock()
+	return Parse(raw, code)
+}
+
+// Parse returns a phone number in E.164 format, e.g. "+18025551234". Numbers
+// starting with "+" or an international prefix are read as international;
+// anything else is read as a national number in regionCode.
+func Parse(raw, regionCode string) (string, error) {
+	digits, international, err := clean(raw)
+	if err != nil {
+		return "", err
+	}
+
+	if !international {
+		r, ok := regions[strings.ToUpper(regionCode)]
+		if !ok {
+			return "", fmt.Errorf("%w: %q has no country code", ErrInvalid, raw)
+		}
+
+		switch {
+		case strings.HasPrefix(digits, "00") && r.callingCode != "1":
+			digits = digits[2:]
+		case strings.HasPrefix(digits, "011") && r.callingCode == "1":
+			digits = digits[3:]
+		case r.callingCode == "1" && len(digits) == 11 && digits[0] == '1':
+			// North American numbers are often written with the leading 1
+		default:
+			if r.trunkPrefix != "" {
+				digits = strings.TrimPrefix(digits, r.trunkPrefix)
+			}
+			digits = r.callingCode + digits
+		}
+	}
+
+	if err := validate(digits); err != nil {
+		return "", fmt.Errorf("%w: %q %v", ErrInvalid, raw, err)
+	}
+	return "+" + digits, nil
+}
+
+// FromDigits parses a number given in international format without the leading
+// "+", as TextMagic reports senders and receivers
+func FromDigits(digits string) (string, error) {
+	return Parse("+"+strings.TrimPrefix(digits, "+"), "")
+}
+
+// Digits returns an E.164 number without the leading "+", as TextMagic expects
+func Digits(number string) string {
+	return strings.TrimPrefix(number, "+")
+}
+
+// clean strips formatting characters, reporting whether the number was written with a "+"
+func clean(raw string) (string, bool, error) {
+	raw = strings.TrimSpace(raw)
+	international := strings.HasPrefix(raw, "+")
+	raw = strings.TrimPrefix(raw, "+")
+
+	var b strings.Builder
+	for _, r := range raw {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == ' ' || r == '-' || r == '.' || r == '(' || r == ')':
+		default:
+			return "", false, fmt.Errorf("%w: unexpected %q", ErrInvalid, r)
+		}
+	}
+
+	if b.Len() == 0 {
+		return "", false, fmt.Errorf("%w: no digits", ErrInvalid)
+	}
+	return b.String(), international, nil
+}
+
+// validate checks a number's digits including the country code
+func validate(digits string) error {
+	if len(digits) < 8 || len(digits) > 15 {
+		return errors.New("has the wrong number of digits")
+	}
+	if digits[0] == '0' {
+		return errors.New("has an invalid country code")
+	}
+
+	if digits[0] == '1' {
+		return validateNANP(digits[1:])
+	}
+
+	for _, r := range regions {
+		if !strings.HasPrefix(digits, r.callingCode) {
+			continue
+		}
+		national := digits[len(r.callingCode):]
+		if len(national) < r.minLength || len(national) > r.maxLength {
+			return errors.New("has the wrong number of digits")
+		}
+		if national[0] == '0' {
+			return errors.New("has an invalid area code")
+		}
+	}
+	return nil
+}
+
+// validateNANP checks a North American number: a 3 digit area code and
+// exchange that can't start with 0 or 1, then a 4 digit line number
+func validateNANP(national string) error {
+	if len(national) != 10 {
+		return errors.New("has the wrong number of digits")
+	}
+	if national[0] < '2' {
+		return errors.New("has an invalid area code")
+	}
+	if national[3] < '2' {
+		return errors.New("has an invalid exchange")
+	}
+	return nil
+}
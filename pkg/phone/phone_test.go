@@ -0,0 +1,116 @@
+package phone
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		region  string
+		want    string
+		wantErr bool
+	}{
+		{"US formatted", "(802) 555-1234", "US", "+18025551234", false},
+		{"US dotted", "802.555.1234", "US", "+18025551234", false},
+		{"US with leading 1", "1 802 555 1234", "US", "+18025551234", false},
+		{"international", "+1 802 555 1234", "", "+18025551234", false},
+		{"international ignores region", "+44 20 7946 0958", "US", "+442079460958", false},
+		{"US international prefix", "011 44 20 7946 0958", "US", "+442079460958", false},
+		{"GB trunk prefix", "020 7946 0958", "gb", "+442079460958", false},
+		{"GB international prefix", "0044 20 7946 0958", "GB", "+442079460958", false},
+		{"AU mobile", "0412 345 678", "AU", "+61412345678", false},
+		{"too short", "555-1234", "US", "", true},
+		{"too long", "+1 802 555 12345", "", "", true},
+		{"NANP area code starting with 1", "(102) 555-1234", "US", "", true},
+		{"NANP exchange starting with 1", "(802) 155-1234", "US", "", true},
+		{"trunk prefix kept after country code", "+44 020 7946 0958", "", "", true},
+		{"letters", "802-555-12a4", "US", "", true},
+		{"empty", "  ", "US", "", true},
+		{"national number in unknown region", "020 7946 0958", "ZZ", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.raw, tt.region)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalid) {
+					t.Errorf("Parse(%q, %q) = %q, %v, want ErrInvalid", tt.raw, tt.region, got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q, %q): %v", tt.raw, tt.region, err)
+			}
+			if got != tt.want {
+				t.Errorf("Parse(%q, %q) = %q, want %q", tt.raw, tt.region, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeUsesDefaultRegion(t *testing.T) {
+	t.Cleanup(func() { SetDefaultRegion("US") })
+
+	if err := SetDefaultRegion("xx"); err == nil {
+		t.Error("SetDefaultRegion accepted an unknown region")
+	}
+	if err := SetDefaultRegion("gb"); err != nil {
+		t.Fatalf("SetDefaultRegion: %v", err)
+	}
+
+	got, err := Normalize("020 7946 0958")
+	if err != nil {
+		t.Fatalf("Normalize: %v", err)
+	}
+	if got != "+442079460958" {
+		t.Errorf("Normalize = %q, want +442079460958", got)
+	}
+}
+
+func TestFromDigits(t *testing.T) {
+	tests := []struct {
+		digits  string
+		want    string
+		wantErr bool
+	}{
+		{"18025551234", "+18025551234", false},
+		{"+442079460958", "+442079460958", false},
+		{"0448025551234", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := FromDigits(tt.digits)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("FromDigits(%q) error = %v, wantErr %v", tt.digits, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("FromDigits(%q) = %q, want %q", tt.digits, got, tt.want)
+		}
+	}
+}
+
+func TestTimeZone(t *testing.T) {
+	tests := []struct {
+		number string
+		want   string
+	}{
+		{"+18025551234", "America/New_York"},
+		{"+13105551234", "America/Los_Angeles"},
+		{"+14165551234", "America/Toronto"},
+		{"+18085551234", "Pacific/Honolulu"},
+		{"+19995551234", ""},
+		{"+442079460958", "Europe/London"},
+		{"+61412345678", "Australia/Sydney"},
+		{"+81312345678", ""},
+	}
+
+	for _, tt := range tests {
+		if got := TimeZone(tt.number); got != tt.want {
+			t.Errorf("TimeZone(%q) = %q, want %q", tt.number, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+
+	"sample-golang/pkg/models"
+)
+
+// ErrQueueFull is returned when the queue cannot accept more submissions
+var ErrQueueFull = errors.New("submission queue is full")
+
+// ErrQueueClosed is returned when submissions arrive after Stop was called
+var ErrQueueClosed = errors.New("submission queue is closed")
+
+// ProcessFunc handles a single queued submission
+type ProcessFunc func(ctx context.Context, data models.LandingFormData) error
+
+// Stats describes the current state of the queue
+type Stats struct {
+	Depth    int `json:"depth"`
+	Capacity int `json:"capacity"`
+	Workers  int `json:"workers"`
+	InFlight int `json:"in_flight"`
+}
+
+// Queue defines the interface for a bounded submission queue
+type Queue interface {
+	Enqueue(data models.LandingFormData) error
+	Stats() Stats
+	Start(ctx context.Context)
+	Stop(ctx context.Context) []models.LandingFormData
+}
+
+type queueImpl struct {
+	items    chan models.LandingFormData
+	workers  int
+	process  ProcessFunc
+	inFlight int64
+	closed   bool
+	cancel   context.CancelFunc
+	abort    chan struct{}
+	leftover []models.LandingFormData
+	mu       sync.RWMutex
+	wg       sync.WaitGroup
+}
+
+// NewQueue creates a queue that holds up to size submissions and processes
+// them with a fixed number of workers
+func NewQueue(workers, size int, process ProcessFunc) Queue {
+	if workers < 1 {
+		workers = 1
+	}
+	if size < 0 {
+		size = 0
+	}
+
+	return &queueImpl{
+		items:   make(chan models.LandingFormData, size),
+		workers: workers,
+		process: process,
+		abort:   make(chan struct{}),
+	}
+}
+
+// Enqueue adds a submission without blocking, failing if the queue is full
+func (q *queueImpl) Enqueue(data models.LandingFormData) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		return ErrQueueClosed
+	}
+
+	select {
+	case q.items <- data:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Stats reports queue depth and worker utilization
+func (q *queueImpl) Stats() Stats {
+	return Stats{
+		Depth:    len(q.items),
+		Capacity: cap(q.items),
+		Workers:  q.workers,
+		InFlight: int(atomic.LoadInt64(&q.inFlight)),
+	}
+}
+
+// Start launches the worker goroutines, passing ctx to each processed submission
+func (q *queueImpl) Start(ctx context.Context) {
+	ctx, q.cancel = context.WithCancel(ctx)
+	for i := 0; i < q.workers; i++ {
+		q.wg.Add(1)
+		go q.work(ctx)
+	}
+	log.Printf("Started submission queue with %d workers and capacity %d", q.workers, cap(q.items))
+}
+
+// Stop rejects new submissions and waits for queued ones to be processed.
+// If ctx ends first, in-flight work is cancelled and every submission that
+// did not complete is returned so the caller can persist it.
+func (q *queueImpl) Stop(ctx context.Context) []models.LandingFormData {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.items)
+	}
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Printf("Drain timeout reached with %+v, cancelling remaining submissions", q.Stats())
+		close(q.abort)
+		q.cancel()
+		<-done
+	}
+
+	q.cancel()
+	return q.leftover
+}
+
+func (q *queueImpl) work(ctx context.Context) {
+	defer q.wg.Done()
+
+	for data := range q.items {
+		select {
+		case <-q.abort:
+			q.keep(data)
+			continue
+		default:
+		}
+
+		atomic.AddInt64(&q.inFlight, 1)
+		err := q.process(ctx, data)
+		atomic.AddInt64(&q.inFlight, -1)
+
+		if err == nil {
+			continue
+		}
+
+		log.Printf("Error processing submission: %v", err)
+		// Submissions interrupted by shutdown are safe to run again
+		if ctx.Err() != nil {
+			q.keep(data)
+		}
+	}
+}
+
+// keep records a submission that was not processed before shutdown
+func (q *queueImpl) keep(data models.LandingFormData) {
+	q.mu.Lock()
+	q.leftover = append(q.leftover, data)
+	q.mu.Unlock()
+}
@@ -0,0 +1,135 @@
+package ratelimit
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"sample-golang/pkg/resp"
+)
+
+// Backend defines the interface for storing sliding-window request counts
+type Backend interface {
+	Allow(key string, limit Limit) (bool, time.Duration, error)
+}
+
+type memoryBackend struct {
+	windows   map[string]*window
+	lastSweep time.Time
+	mu        sync.Mutex
+}
+
+// window holds the recent request times for one key
+type window struct {
+	times  []time.Time
+	length time.Duration
+}
+
+// NewMemoryBackend creates a backend that keeps counts in process memory
+func NewMemoryBackend() Backend {
+	return &memoryBackend{
+		windows:   make(map[string]*window),
+		lastSweep: time.Now(),
+	}
+}
+
+func (b *memoryBackend) Allow(key string, limit Limit) (bool, time.Duration, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.sweep(now)
+
+	w, ok := b.windows[key]
+	if !ok {
+		w = &window{}
+		b.windows[key] = w
+	}
+	w.length = limit.Window
+	w.times = prune(w.times, now.Add(-limit.Window))
+
+	if len(w.times) >= limit.Requests {
+		return false, w.times[0].Add(limit.Window).Sub(now), nil
+	}
+
+	w.times = append(w.times, now)
+	return true, 0, nil
+}
+
+// sweep drops idle keys once a minute so memory doesn't grow without bound
+func (b *memoryBackend) sweep(now time.Time) {
+	if now.Sub(b.lastSweep) < time.Minute {
+		return
+	}
+	b.lastSweep = now
+
+	for key, w := range b.windows {
+		if len(w.times) == 0 || now.Sub(w.times[len(w.times)-1]) > w.length {
+			delete(b.windows, key)
+		}
+	}
+}
+
+// prune drops request times older than cutoff
+func prune(times []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(times) && !times[i].After(cutoff) {
+		i++
+	}
+	return times[i:]
+}
+
+// slidingWindowScript trims, counts and records a request atomically. It
+// returns -1 if the request is allowed, otherwise milliseconds until it would be.
+const slidingWindowScript = `
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], 0, now - window)
+if redis.call('ZCARD', KEYS[1]) < tonumber(ARGV[3]) then
+	redis.call('ZADD', KEYS[1], now, ARGV[4])
+	redis.call('PEXPIRE', KEYS[1], window)
+	return -1
+end
+local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+return tonumber(oldest[2]) + window - now
+`
+
+type redisBackend struct {
+	client resp.Client
+	prefix string
+}
+
+// NewRedisBackend creates a backend shared by every instance using the same Redis server
+func NewRedisBackend(client resp.Client, prefix string) Backend {
+	return &redisBackend{
+		client: client,
+		prefix: prefix,
+	}
+}
+
+func (b *redisBackend) Allow(key string, limit Limit) (bool, time.Duration, error) {
+	member := make([]byte, 8)
+	if _, err := rand.Read(member); err != nil {
+		return false, 0, fmt.Errorf("error generating request ID: %w", err)
+	}
+
+	now := time.Now().UnixMilli()
+	wait, err := resp.Int(b.client.Do(
+		"EVAL", slidingWindowScript, "1", b.prefix+key,
+		strconv.FormatInt(now, 10),
+		strconv.FormatInt(limit.Window.Milliseconds(), 10),
+		strconv.Itoa(limit.Requests),
+		strconv.FormatInt(now, 10)+"-"+hex.EncodeToString(member),
+	))
+	if err != nil {
+		return false, 0, fmt.Errorf("error checking rate limit: %w", err)
+	}
+
+	if wait < 0 {
+		return true, 0, nil
+	}
+	return false, time.Duration(wait) * time.Millisecond, nil
+}
@@ -0,0 +1,139 @@
+package ratelimit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxJSONBody bounds how much of a body ByJSONField reads to find its key
+const maxJSONBody = 1 << 20
+
+// Limit is a maximum number of requests allowed within a sliding window
+type Limit struct {
+	Requests int
+	Window   time.Duration
+}
+
+// KeyFunc extracts the value a rule limits on, returning "" to skip the rule.
+// It may abort the request, e.g. when the body can't be read.
+type KeyFunc func(c *gin.Context) string
+
+// Rule applies a limit to requests grouped by a key
+type Rule struct {
+	Name  string
+	Limit Limit
+	Key   KeyFunc
+}
+
+// ParseLimit parses limits written as "<requests>/<window>", e.g. "10/1m".
+// An empty string disables the limit.
+func ParseLimit(value string) (Limit, error) {
+	if value == "" {
+		return Limit{}, nil
+	}
+
+	requests, window, ok := strings.Cut(value, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid rate limit %q, expected <requests>/<window>", value)
+	}
+
+	n, err := strconv.Atoi(requests)
+	if err != nil || n < 1 {
+		return Limit{}, fmt.Errorf("invalid request count in rate limit %q", value)
+	}
+
+	d, err := time.ParseDuration(window)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("invalid window in rate limit %q", value)
+	}
+
+	return Limit{Requests: n, Window: d}, nil
+}
+
+// ByIP keys requests by client IP address
+func ByIP() KeyFunc {
+	return func(c *gin.Context) string {
+		return c.ClientIP()
+	}
+}
+
+// ByJSONField keys requests by a top-level string field in the JSON body,
+// passed through normalize so equivalent values share a limit. Bodies over
+// 1 MB are rejected with 413 rather than read into memory.
+func ByJSONField(field string, normalize func(string) string) KeyFunc {
+	return func(c *gin.Context) string {
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxJSONBody))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Request too large"})
+			} else {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Error reading request"})
+			}
+			return ""
+		}
+		// Put the body back so the handler can read it
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		var fields map[string]interface{}
+		if err := json.Unmarshal(body, &fields); err != nil {
+			return ""
+		}
+
+		value, _ := fields[field].(string)
+		if value == "" {
+			return ""
+		}
+		if normalize != nil {
+			value = normalize(value)
+		}
+		return value
+	}
+}
+
+// Middleware rejects requests with 429 once any rule's limit is exceeded.
+// The route name keeps counters for different routes apart in a shared backend.
+func Middleware(backend Backend, route string, rules ...Rule) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, rule := range rules {
+			if rule.Limit.Requests == 0 {
+				continue
+			}
+
+			key := rule.Key(c)
+			if c.IsAborted() {
+				return
+			}
+			if key == "" {
+				continue
+			}
+
+			allowed, retryAfter, err := backend.Allow(route+":"+rule.Name+":"+key, rule.Limit)
+			if err != nil {
+				// Fail open so a backend outage doesn't take the endpoint down
+				log.Printf("Error checking %s rate limit for %s: %v", rule.Name, route, err)
+				continue
+			}
+
+			if !allowed {
+				log.Printf("Rate limited %s on %s by %s", c.ClientIP(), route, rule.Name)
+				c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+				c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests, please try again later"})
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,169 @@
+package ratelimit
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Limit
+		wantErr bool
+	}{
+		{"10/1m", Limit{Requests: 10, Window: time.Minute}, false},
+		{"3/1h", Limit{Requests: 3, Window: time.Hour}, false},
+		{"", Limit{}, false},
+		{"10", Limit{}, true},
+		{"0/1m", Limit{}, true},
+		{"ten/1m", Limit{}, true},
+		{"10/soon", Limit{}, true},
+		{"10/-1m", Limit{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseLimit(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseLimit(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseLimit(%q) = %+v, want %+v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestMemoryBackendSlidingWindow(t *testing.T) {
+	backend := NewMemoryBackend()
+	limit := Limit{Requests: 2, Window: 100 * time.Millisecond}
+
+	for i, want := range []bool{true, true, false} {
+		allowed, retryAfter, err := backend.Allow("key", limit)
+		if err != nil {
+			t.Fatalf("Allow: %v", err)
+		}
+		if allowed != want {
+			t.Fatalf("request %d: allowed = %v, want %v", i+1, allowed, want)
+		}
+		if !allowed && (retryAfter <= 0 || retryAfter > limit.Window) {
+			t.Errorf("retryAfter = %s, want within the window", retryAfter)
+		}
+	}
+
+	// Other keys have limits of their own
+	if allowed, _, _ := backend.Allow("other", limit); !allowed {
+		t.Error("a different key was limited")
+	}
+
+	// Requests leave the window as it slides past them
+	time.Sleep(limit.Window + 20*time.Millisecond)
+	if allowed, _, _ := backend.Allow("key", limit); !allowed {
+		t.Error("request after the window was limited")
+	}
+}
+
+// keyFor runs key against a request and returns the key, the status if the
+// request was aborted, and the body left for the handler
+func keyFor(key KeyFunc, req *http.Request) (string, int, string) {
+	gin.SetMode(gin.TestMode)
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = req
+
+	got := key(c)
+	status := 0
+	if c.IsAborted() {
+		status = rec.Code
+	}
+	body, _ := io.ReadAll(c.Request.Body)
+	return got, status, string(body)
+}
+
+func TestByJSONField(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		want       string
+		wantStatus int
+	}{
+		{name: "string field", body: `{"phone":" +1 555 "}`, want: "+1 555"},
+		{name: "missing field", body: `{"name":"Ada"}`},
+		{name: "not a string", body: `{"phone":5551234}`},
+		{name: "invalid JSON", body: `{"phone":`},
+		{name: "too large", body: `{"phone":"1","pad":"` + strings.Repeat("x", maxJSONBody) + `"}`, wantStatus: http.StatusRequestEntityTooLarge},
+	}
+
+	key := ByJSONField("phone", strings.TrimSpace)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			got, status, body := keyFor(key, req)
+			if got != tt.want || status != tt.wantStatus {
+				t.Errorf("key = %q with status %d, want %q with status %d", got, status, tt.want, tt.wantStatus)
+			}
+			if tt.wantStatus == 0 && body != tt.body {
+				t.Errorf("body left for the handler = %q, want %q", body, tt.body)
+			}
+		})
+	}
+}
+
+func TestByIP(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.RemoteAddr = "203.0.113.7:4000"
+	// Without trusted proxies a forwarded address is ignored
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	if err := router.SetTrustedProxies(nil); err != nil {
+		t.Fatalf("SetTrustedProxies: %v", err)
+	}
+	var got string
+	router.POST("/", func(c *gin.Context) {
+		got = ByIP()(c)
+	})
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got != "203.0.113.7" {
+		t.Errorf("key = %q, want the connecting address", got)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/", Middleware(NewMemoryBackend(), "test",
+		Rule{Name: "phone", Limit: Limit{Requests: 1, Window: time.Minute}, Key: ByJSONField("phone", nil)},
+	), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		body string
+		want int
+	}{
+		{`{"phone":"1"}`, http.StatusOK},
+		{`{"phone":"1"}`, http.StatusTooManyRequests},
+		{`{"phone":"2"}`, http.StatusOK},
+		{`{}`, http.StatusOK},
+		{`{}`, http.StatusOK},
+	}
+
+	for i, tt := range tests {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body)))
+		if rec.Code != tt.want {
+			t.Errorf("request %d: status = %d, want %d", i+1, rec.Code, tt.want)
+		}
+		if rec.Code == http.StatusTooManyRequests && rec.Header().Get("Retry-After") == "" {
+			t.Errorf("request %d: no Retry-After header", i+1)
+		}
+	}
+}
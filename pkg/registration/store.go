@@ -0,0 +1,70 @@
+package registration
+
+import (
+	"errors"
+	"time"
+
+	"sample-golang/pkg/docstore"
+)
+
+// Record notes that a phone hash finished registering
+type Record struct {
+	Source      string    `json:"source"`
+	Reference   string    `json:"reference,omitempty"`
+	CompletedAt time.Time `json:"completed_at"`
+}
+
+// Store defines the interface for tracking who has finished registering, so
+// reminders can stop without waiting to find them in Airtable
+type Store interface {
+	MarkComplete(phoneHash string, record Record) error
+	// IsComplete reports whether any of the hashes has finished registering
+	IsComplete(phoneHashes ...string) (bool, error)
+	Delete(phoneHash string) error
+	List() (map[string]Record, error)
+}
+
+type storeImpl struct {
+	records docstore.Collection[Record]
+}
+
+// NewStore creates a store that keeps registrations in the "registrations" collection
+func NewStore(backend docstore.Backend) Store {
+	return &storeImpl{records: docstore.NewCollection[Record](backend, "registrations")}
+}
+
+func (s *storeImpl) MarkComplete(phoneHash string, record Record) error {
+	if record.CompletedAt.IsZero() {
+		record.CompletedAt = time.Now()
+	}
+
+	return s.records.Update(phoneHash, func(existing *Record, exists bool) (bool, error) {
+		// Keep the first completion; later ones are usually webhook retries
+		if exists {
+			return false, nil
+		}
+		*existing = record
+		return true, nil
+	})
+}
+
+func (s *storeImpl) IsComplete(phoneHashes ...string) (bool, error) {
+	for _, hash := range phoneHashes {
+		_, err := s.records.Get(hash)
+		if err == nil {
+			return true, nil
+		}
+		if !errors.Is(err, docstore.ErrNotFound) {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+func (s *storeImpl) Delete(phoneHash string) error {
+	return s.records.Delete(phoneHash)
+}
+
+func (s *storeImpl) List() (map[string]Record, error) {
+	return s.records.List("")
+}
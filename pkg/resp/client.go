@@ -0,0 +1,379 @@
+package resp
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNil is returned when the server replies with a null value
+	ErrNil = errors.New("resp: nil reply")
+	// ErrConflict is returned by Watch when a watched key changed before EXEC
+	ErrConflict = errors.New("resp: watched key changed")
+)
+
+// Error is an error reply sent by the server
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+// Conn sends commands on a single connection
+type Conn interface {
+	Do(args ...string) (interface{}, error)
+}
+
+// Client defines the interface for talking to a Redis-protocol server
+type Client interface {
+	Conn
+
+	// Watch watches keys, then calls fn on the same connection to read what it
+	// needs and return the commands to run. The commands run in one MULTI/EXEC
+	// block, whose replies are returned, unless a watched key changed first, in
+	// which case ErrConflict is returned and nothing is written. Nothing is run
+	// either if fn returns an error or no commands.
+	Watch(keys []string, fn func(conn Conn) ([][]string, error)) ([]interface{}, error)
+	Close() error
+}
+
+type clientImpl struct {
+	addr      string
+	username  string
+	password  string
+	tlsConfig *tls.Config
+	timeout   time.Duration
+	conns     chan *conn
+}
+
+type conn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+// NewClient creates a client for the server at addr, given as host:port or as
+// a redis:// or rediss:// URL. rediss:// connects over TLS, and credentials in
+// the URL take the place of password. Connections are opened lazily and up to
+// poolSize of them are kept for reuse.
+func NewClient(addr, password string, poolSize int) (Client, error) {
+	if poolSize < 1 {
+		poolSize = 1
+	}
+
+	c := &clientImpl{
+		addr:     addr,
+		password: password,
+		timeout:  5 * time.Second,
+		conns:    make(chan *conn, poolSize),
+	}
+
+	if strings.Contains(addr, "://") {
+		u, err := url.Parse(addr)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing Redis URL: %w", err)
+		}
+
+		switch u.Scheme {
+		case "redis":
+		case "rediss":
+			c.tlsConfig = &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12}
+		default:
+			return nil, fmt.Errorf("unsupported Redis URL scheme %q", u.Scheme)
+		}
+
+		c.addr = u.Host
+		if u.Port() == "" {
+			c.addr = net.JoinHostPort(u.Hostname(), "6379")
+		}
+		if pass, ok := u.User.Password(); ok {
+			c.username = u.User.Username()
+			c.password = pass
+		}
+	}
+	return c, nil
+}
+
+// Do sends a command and returns its reply. Replies are decoded as string,
+// int64, []interface{} or nil; server errors are returned as Error.
+func (c *clientImpl) Do(args ...string) (interface{}, error) {
+	cn, err := c.get()
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := cn.do(c.timeout, args...)
+	if err != nil {
+		var serverErr Error
+		if !errors.As(err, &serverErr) {
+			// The connection state is unknown after an I/O error
+			cn.Close()
+			return nil, err
+		}
+	}
+
+	c.put(cn)
+	return reply, err
+}
+
+func (c *clientImpl) Watch(keys []string, fn func(conn Conn) ([][]string, error)) ([]interface{}, error) {
+	cn, err := c.get()
+	if err != nil {
+		return nil, err
+	}
+
+	tx := &txConn{conn: cn, timeout: c.timeout}
+	replies, err := tx.run(keys, fn)
+	if tx.broken {
+		// Closing the connection drops any watch or transaction left on it
+		cn.Close()
+	} else {
+		c.put(cn)
+	}
+	return replies, err
+}
+
+// txConn is a connection held for one transaction. It is broken once its state
+// on the server is unknown, and then isn't reused.
+type txConn struct {
+	conn    *conn
+	timeout time.Duration
+	broken  bool
+}
+
+func (tx *txConn) Do(args ...string) (interface{}, error) {
+	reply, err := tx.conn.do(tx.timeout, args...)
+	var serverErr Error
+	if err != nil && !errors.As(err, &serverErr) {
+		tx.broken = true
+	}
+	return reply, err
+}
+
+func (tx *txConn) run(keys []string, fn func(conn Conn) ([][]string, error)) ([]interface{}, error) {
+	if len(keys) > 0 {
+		if _, err := tx.Do(append([]string{"WATCH"}, keys...)...); err != nil {
+			tx.broken = true
+			return nil, err
+		}
+	}
+
+	commands, err := fn(tx)
+	if err != nil || len(commands) == 0 {
+		if len(keys) > 0 {
+			if _, unwatchErr := tx.Do("UNWATCH"); unwatchErr != nil {
+				tx.broken = true
+			}
+		}
+		return nil, err
+	}
+
+	if _, err := tx.Do("MULTI"); err != nil {
+		tx.broken = true
+		return nil, err
+	}
+	for _, command := range commands {
+		if _, err := tx.Do(command...); err != nil {
+			tx.broken = true
+			return nil, err
+		}
+	}
+
+	reply, err := tx.Do("EXEC")
+	if err != nil {
+		tx.broken = true
+		return nil, err
+	}
+	if reply == nil {
+		return nil, ErrConflict
+	}
+	replies, ok := reply.([]interface{})
+	if !ok {
+		tx.broken = true
+		return nil, fmt.Errorf("resp: unexpected reply %T for EXEC", reply)
+	}
+	return replies, nil
+}
+
+// Close closes all pooled connections
+func (c *clientImpl) Close() error {
+	for {
+		select {
+		case cn := <-c.conns:
+			cn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+func (c *clientImpl) get() (*conn, error) {
+	select {
+	case cn := <-c.conns:
+		return cn, nil
+	default:
+	}
+
+	nc, err := c.dial()
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to %s: %w", c.addr, err)
+	}
+
+	cn := &conn{Conn: nc, reader: bufio.NewReader(nc)}
+	if c.password != "" {
+		auth := []string{"AUTH", c.password}
+		if c.username != "" {
+			auth = []string{"AUTH", c.username, c.password}
+		}
+		if _, err := cn.do(c.timeout, auth...); err != nil {
+			cn.Close()
+			return nil, fmt.Errorf("error authenticating to %s: %w", c.addr, err)
+		}
+	}
+	return cn, nil
+}
+
+func (c *clientImpl) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: c.timeout}
+	if c.tlsConfig != nil {
+		return tls.DialWithDialer(dialer, "tcp", c.addr, c.tlsConfig)
+	}
+	return dialer.Dial("tcp", c.addr)
+}
+
+func (c *clientImpl) put(cn *conn) {
+	select {
+	case c.conns <- cn:
+	default:
+		cn.Close()
+	}
+}
+
+func (cn *conn) do(timeout time.Duration, args ...string) (interface{}, error) {
+	if err := cn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+
+	if _, err := cn.Write(EncodeCommand(args...)); err != nil {
+		return nil, fmt.Errorf("error writing command: %w", err)
+	}
+
+	return ReadReply(cn.reader)
+}
+
+// EncodeCommand encodes args as a RESP array of bulk strings
+func EncodeCommand(args ...string) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	return []byte(b.String())
+}
+
+// ReadReply reads a single RESP value from r
+func ReadReply(r *bufio.Reader) (interface{}, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, errors.New("resp: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, Error(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("resp: invalid bulk length: %w", err)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("resp: invalid array length: %w", err)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			item, err := ReadReply(r)
+			// Keep reading after an error element so the stream stays in sync
+			var serverErr Error
+			if err != nil && !errors.As(err, &serverErr) {
+				return nil, err
+			}
+			if err != nil {
+				items[i] = serverErr
+			} else {
+				items[i] = item
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("resp: unexpected reply type %q", line[0])
+	}
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), nil
+}
+
+// String converts a reply to a string, returning ErrNil for null replies
+func String(reply interface{}, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+	switch v := reply.(type) {
+	case string:
+		return v, nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case nil:
+		return "", ErrNil
+	default:
+		return "", fmt.Errorf("resp: unexpected reply %T for string", reply)
+	}
+}
+
+// Int converts a reply to an int64
+func Int(reply interface{}, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+	switch v := reply.(type) {
+	case int64:
+		return v, nil
+	case string:
+		return strconv.ParseInt(v, 10, 64)
+	case nil:
+		return 0, ErrNil
+	default:
+		return 0, fmt.Errorf("resp: unexpected reply %T for integer", reply)
+	}
+}
@@ -0,0 +1,399 @@
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server is a small in-process stand-in for Redis. It speaks enough of the
+// protocol for local development and for exercising the Redis-backed stores
+// without a real server, including WATCH/MULTI/EXEC transactions; it does not
+// support scripting or persistence.
+type Server struct {
+	password string
+	values   map[string]entry
+	// versions counts writes to each key so EXEC can tell a watched key changed
+	versions map[string]uint64
+	mu       sync.Mutex
+	listener net.Listener
+}
+
+// session is the transaction state of one connection
+type session struct {
+	watched map[string]uint64
+	multi   bool
+	queued  [][]string
+}
+
+type entry struct {
+	value     string
+	expiresAt time.Time
+}
+
+// NewServer creates an embedded server that requires password if it is not empty
+func NewServer(password string) *Server {
+	return &Server{
+		password: password,
+		values:   make(map[string]entry),
+		versions: make(map[string]uint64),
+	}
+}
+
+// Listen starts serving on addr in the background and returns the bound address
+func (s *Server) Listen(addr string) (string, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", fmt.Errorf("error starting embedded server: %w", err)
+	}
+	s.listener = l
+
+	go s.serve()
+	return l.Addr().String(), nil
+}
+
+// Close stops accepting connections
+func (s *Server) Close() error {
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Close()
+}
+
+func (s *Server) serve() {
+	for {
+		c, err := s.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("Embedded server accept error: %v", err)
+			}
+			return
+		}
+		go s.handle(c)
+	}
+}
+
+func (s *Server) handle(c net.Conn) {
+	defer c.Close()
+
+	reader := bufio.NewReader(c)
+	authed := s.password == ""
+	sess := &session{}
+
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				log.Printf("Embedded server read error: %v", err)
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		name := strings.ToUpper(args[0])
+		var reply string
+		switch {
+		case name == "AUTH":
+			// Any username is accepted, as with Redis's default user
+			if (len(args) == 2 || len(args) == 3) && args[len(args)-1] == s.password {
+				authed = true
+				reply = "+OK\r\n"
+			} else {
+				reply = "-ERR invalid password\r\n"
+			}
+		case !authed:
+			reply = "-NOAUTH Authentication required.\r\n"
+		default:
+			reply = s.dispatch(sess, name, args[1:])
+		}
+
+		if _, err := io.WriteString(c, reply); err != nil {
+			return
+		}
+	}
+}
+
+// dispatch handles the transaction commands and queues others inside MULTI
+func (s *Server) dispatch(sess *session, name string, args []string) string {
+	switch name {
+	case "WATCH":
+		if sess.multi {
+			return "-ERR WATCH inside MULTI is not allowed\r\n"
+		}
+		if len(args) == 0 {
+			return wrongArgs(name)
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if sess.watched == nil {
+			sess.watched = make(map[string]uint64)
+		}
+		now := time.Now()
+		for _, key := range args {
+			s.get(key, now)
+			sess.watched[key] = s.versions[key]
+		}
+		return "+OK\r\n"
+	case "UNWATCH":
+		sess.watched = nil
+		return "+OK\r\n"
+	case "MULTI":
+		if sess.multi {
+			return "-ERR MULTI calls can not be nested\r\n"
+		}
+		sess.multi = true
+		return "+OK\r\n"
+	case "DISCARD":
+		if !sess.multi {
+			return "-ERR DISCARD without MULTI\r\n"
+		}
+		*sess = session{}
+		return "+OK\r\n"
+	case "EXEC":
+		if !sess.multi {
+			return "-ERR EXEC without MULTI\r\n"
+		}
+		return s.execQueued(sess)
+	}
+
+	if sess.multi {
+		sess.queued = append(sess.queued, append([]string{name}, args...))
+		return "+QUEUED\r\n"
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.exec(name, args, time.Now())
+}
+
+// execQueued runs a transaction's commands together, or none of them if a
+// watched key was written since WATCH
+func (s *Server) execQueued(sess *session) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer func() { *sess = session{} }()
+
+	now := time.Now()
+	for key, version := range sess.watched {
+		s.get(key, now)
+		if s.versions[key] != version {
+			return "*-1\r\n"
+		}
+	}
+
+	reply := fmt.Sprintf("*%d\r\n", len(sess.queued))
+	for _, args := range sess.queued {
+		reply += s.exec(args[0], args[1:], now)
+	}
+	return reply
+}
+
+// exec runs a command with s.mu held and returns its encoded reply
+func (s *Server) exec(name string, args []string, now time.Time) string {
+	switch name {
+	case "PING":
+		return "+PONG\r\n"
+	case "GET":
+		if len(args) != 1 {
+			return wrongArgs(name)
+		}
+		e, ok := s.get(args[0], now)
+		if !ok {
+			return "$-1\r\n"
+		}
+		return bulk(e.value)
+	case "MGET":
+		if len(args) == 0 {
+			return wrongArgs(name)
+		}
+		reply := fmt.Sprintf("*%d\r\n", len(args))
+		for _, key := range args {
+			if e, ok := s.get(key, now); ok {
+				reply += bulk(e.value)
+			} else {
+				reply += "$-1\r\n"
+			}
+		}
+		return reply
+	case "SET":
+		if len(args) < 2 {
+			return wrongArgs(name)
+		}
+		e := entry{value: args[1]}
+		onlyNew := false
+		for i := 2; i < len(args); i++ {
+			switch option := strings.ToUpper(args[i]); option {
+			case "NX":
+				onlyNew = true
+			case "EX", "PX":
+				if i+1 == len(args) {
+					return "-ERR syntax error\r\n"
+				}
+				n, err := strconv.ParseInt(args[i+1], 10, 64)
+				if err != nil {
+					return "-ERR value is not an integer or out of range\r\n"
+				}
+				unit := time.Millisecond
+				if option == "EX" {
+					unit = time.Second
+				}
+				e.expiresAt = now.Add(time.Duration(n) * unit)
+				i++
+			default:
+				return "-ERR syntax error\r\n"
+			}
+		}
+		if _, exists := s.get(args[0], now); exists && onlyNew {
+			return "$-1\r\n"
+		}
+		s.set(args[0], e)
+		return "+OK\r\n"
+	case "DEL":
+		removed := 0
+		for _, key := range args {
+			if _, ok := s.get(key, now); ok {
+				s.remove(key)
+				removed++
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", removed)
+	case "EXISTS":
+		count := 0
+		for _, key := range args {
+			if _, ok := s.get(key, now); ok {
+				count++
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", count)
+	case "INCR":
+		if len(args) != 1 {
+			return wrongArgs(name)
+		}
+		e, _ := s.get(args[0], now)
+		n, err := strconv.ParseInt(defaultString(e.value, "0"), 10, 64)
+		if err != nil {
+			return "-ERR value is not an integer or out of range\r\n"
+		}
+		e.value = strconv.FormatInt(n+1, 10)
+		s.set(args[0], e)
+		return fmt.Sprintf(":%d\r\n", n+1)
+	case "PEXPIRE", "EXPIRE":
+		if len(args) != 2 {
+			return wrongArgs(name)
+		}
+		n, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return "-ERR value is not an integer or out of range\r\n"
+		}
+		e, ok := s.get(args[0], now)
+		if !ok {
+			return ":0\r\n"
+		}
+		unit := time.Millisecond
+		if name == "EXPIRE" {
+			unit = time.Second
+		}
+		e.expiresAt = now.Add(time.Duration(n) * unit)
+		s.set(args[0], e)
+		return ":1\r\n"
+	case "PEXPIREAT":
+		if len(args) != 2 {
+			return wrongArgs(name)
+		}
+		ms, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return "-ERR value is not an integer or out of range\r\n"
+		}
+		e, ok := s.get(args[0], now)
+		if !ok {
+			return ":0\r\n"
+		}
+		e.expiresAt = time.UnixMilli(ms)
+		s.set(args[0], e)
+		return ":1\r\n"
+	case "PTTL":
+		if len(args) != 1 {
+			return wrongArgs(name)
+		}
+		e, ok := s.get(args[0], now)
+		if !ok {
+			return ":-2\r\n"
+		}
+		if e.expiresAt.IsZero() {
+			return ":-1\r\n"
+		}
+		return fmt.Sprintf(":%d\r\n", e.expiresAt.Sub(now).Milliseconds())
+	default:
+		return fmt.Sprintf("-ERR unknown command '%s'\r\n", name)
+	}
+}
+
+// get returns a live entry, dropping it if it has expired
+func (s *Server) get(key string, now time.Time) (entry, bool) {
+	e, ok := s.values[key]
+	if !ok {
+		return entry{}, false
+	}
+	if !e.expiresAt.IsZero() && now.After(e.expiresAt) {
+		s.remove(key)
+		return entry{}, false
+	}
+	return e, true
+}
+
+func (s *Server) set(key string, e entry) {
+	s.values[key] = e
+	s.versions[key]++
+}
+
+func (s *Server) remove(key string) {
+	delete(s.values, key)
+	s.versions[key]++
+}
+
+// readCommand reads a client command sent as a RESP array of bulk strings
+func readCommand(r *bufio.Reader) ([]string, error) {
+	reply, err := ReadReply(r)
+	if err != nil {
+		return nil, err
+	}
+
+	items, ok := reply.([]interface{})
+	if !ok {
+		return nil, errors.New("resp: expected command array")
+	}
+
+	args := make([]string, len(items))
+	for i, item := range items {
+		arg, ok := item.(string)
+		if !ok {
+			return nil, errors.New("resp: expected bulk string argument")
+		}
+		args[i] = arg
+	}
+	return args, nil
+}
+
+func bulk(value string) string {
+	return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+}
+
+func wrongArgs(name string) string {
+	return fmt.Sprintf("-ERR wrong number of arguments for '%s' command\r\n", strings.ToLower(name))
+}
+
+func defaultString(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
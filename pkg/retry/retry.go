@@ -0,0 +1,151 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Retryable is implemented by errors that know whether the call may succeed if repeated
+type Retryable interface {
+	Retryable() bool
+}
+
+// Replayable is implemented by errors that know whether a call that isn't safe
+// to repeat, such as sending a message, can be retried without doing it twice
+type Replayable interface {
+	Replayable() bool
+}
+
+// RetryAfterer is implemented by errors that carry a server-requested delay
+type RetryAfterer interface {
+	RetryAfter() time.Duration
+}
+
+// Policy describes how many times and how long to wait between attempts
+type Policy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// DefaultPolicy is used for vendor API calls
+var DefaultPolicy = Policy{
+	MaxAttempts: 4,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    30 * time.Second,
+}
+
+// Do calls fn until it succeeds, returns a permanent error, attempts run out,
+// or ctx is done
+func (p Policy) Do(ctx context.Context, name string, fn func() error) error {
+	return p.do(ctx, name, fn, IsRetryable)
+}
+
+// DoNonIdempotent is Do for calls that create something. It only retries
+// failures that show the previous attempt had no effect, so a request that
+// timed out after reaching the server is never sent again.
+func (p Policy) DoNonIdempotent(ctx context.Context, name string, fn func() error) error {
+	return p.do(ctx, name, fn, IsReplayable)
+}
+
+func (p Policy) do(ctx context.Context, name string, fn func() error, retryable func(error) bool) error {
+	var err error
+	for attempt := 1; attempt <= p.MaxAttempts; attempt++ {
+		err = fn()
+		if err == nil {
+			return nil
+		}
+
+		if !retryable(err) || attempt == p.MaxAttempts || ctx.Err() != nil {
+			return err
+		}
+
+		delay := p.backoff(attempt)
+		var ra RetryAfterer
+		if errors.As(err, &ra) && ra.RetryAfter() > delay {
+			delay = ra.RetryAfter()
+		}
+
+		log.Printf("%s failed (attempt %d/%d), retrying in %s: %v", name, attempt, p.MaxAttempts, delay, err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+	}
+	return err
+}
+
+// backoff returns a full-jitter exponential delay for the given attempt
+func (p Policy) backoff(attempt int) time.Duration {
+	ceiling := p.BaseDelay << uint(attempt-1)
+	if ceiling <= 0 || ceiling > p.MaxDelay {
+		ceiling = p.MaxDelay
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling)) + 1)
+}
+
+// IsRetryable reports whether err is marked as retryable
+func IsRetryable(err error) bool {
+	var r Retryable
+	return errors.As(err, &r) && r.Retryable()
+}
+
+// IsReplayable reports whether err is marked as safe to retry a non-idempotent call
+func IsReplayable(err error) bool {
+	var r Replayable
+	return errors.As(err, &r) && r.Replayable()
+}
+
+// IsRetryableStatus reports whether an HTTP status code indicates a transient failure
+func IsRetryableStatus(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode == http.StatusRequestTimeout || statusCode >= 500
+}
+
+// IsUnprocessedStatus reports whether an HTTP status code means the server
+// turned the request away without acting on it
+func IsUnprocessedStatus(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode == http.StatusServiceUnavailable
+}
+
+// TraceWrite returns a copy of req that records whether any of it was written
+// to the connection. Until it has been, a failed request can't have had an effect.
+func TraceWrite(req *http.Request) (*http.Request, func() bool) {
+	var wrote atomic.Bool
+	trace := &httptrace.ClientTrace{
+		WroteHeaderField: func(string, []string) { wrote.Store(true) },
+		WroteRequest:     func(httptrace.WroteRequestInfo) { wrote.Store(true) },
+	}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace)), wrote.Load
+}
+
+// ParseRetryAfter reads a Retry-After header given in seconds or as an HTTP date
+func ParseRetryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if at, err := http.ParseTime(header); err == nil {
+		if d := time.Until(at); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
@@ -0,0 +1,47 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type testError struct {
+	retryable  bool
+	replayable bool
+}
+
+func (e testError) Error() string    { return "test error" }
+func (e testError) Retryable() bool  { return e.retryable }
+func (e testError) Replayable() bool { return e.replayable }
+
+func TestDoNonIdempotent(t *testing.T) {
+	policy := Policy{MaxAttempts: 3}
+
+	tests := []struct {
+		name      string
+		err       error
+		wantCalls int
+	}{
+		{"timed out after the request was sent", testError{retryable: true}, 1},
+		{"never reached the server", testError{retryable: true, replayable: true}, 3},
+		{"permanent failure", testError{}, 1},
+		{"unclassified error", errors.New("boom"), 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := policy.DoNonIdempotent(context.Background(), "test", func() error {
+				calls++
+				return tt.err
+			})
+			if err == nil {
+				t.Fatal("DoNonIdempotent succeeded, want the last error")
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("called %d times, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
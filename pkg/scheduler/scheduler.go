@@ -0,0 +1,276 @@
+package scheduler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// claimLease is how long a claimed job is left to its instance. A job whose
+	// instance died mid-run becomes due again once the lease lapses.
+	claimLease = 15 * time.Minute
+	// maxAttempts is how many times a failing job runs before it is dropped
+	maxAttempts = 5
+	// retryBaseDelay doubles after each failed attempt, up to retryMaxDelay
+	retryBaseDelay = time.Minute
+	retryMaxDelay  = time.Hour
+)
+
+// Job represents a unit of work that should run at a given time
+type Job struct {
+	ID      string          `json:"id"`
+	Kind    string          `json:"kind"`
+	Key     string          `json:"key,omitempty"`
+	Payload json.RawMessage `json:"payload"`
+	RunAt   time.Time       `json:"run_at"`
+	// ClaimedUntil is when the lease of the instance running the job ends
+	ClaimedUntil time.Time `json:"claimed_until"`
+	// Attempts counts earlier runs that failed
+	Attempts  int       `json:"attempts,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// claimed reports whether an instance holds a live lease on the job
+func (j Job) claimed(now time.Time) bool {
+	return j.ClaimedUntil.After(now)
+}
+
+// Handler processes a job of a registered kind. Returned errors are retried
+// with backoff unless wrapped with Permanent.
+type Handler func(ctx context.Context, job Job) error
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks a handler error that retrying won't fix, such as a payload
+// that can't be decoded
+func Permanent(err error) error {
+	return permanentError{err: err}
+}
+
+// IsPermanent reports whether err was marked with Permanent
+func IsPermanent(err error) bool {
+	var p permanentError
+	return errors.As(err, &p)
+}
+
+// Scheduler defines the interface for scheduling delayed jobs
+type Scheduler interface {
+	Register(kind string, handler Handler)
+	Schedule(kind string, runAt time.Time, payload interface{}) (string, error)
+	// ScheduleKeyed schedules a job that can later be cancelled by key
+	ScheduleKeyed(kind, key string, runAt time.Time, payload interface{}) (string, error)
+	// Cancel removes pending jobs with key, returning how many there were
+	Cancel(key string) (int, error)
+	Start(ctx context.Context) error
+	Stop(ctx context.Context)
+}
+
+type schedulerImpl struct {
+	store        Store
+	pollInterval time.Duration
+	handlers     map[string]Handler
+	mu           sync.RWMutex
+	cancel       context.CancelFunc
+	stop         chan struct{}
+	done         chan struct{}
+}
+
+// NewScheduler creates a new scheduler backed by the given store
+func NewScheduler(store Store, pollInterval time.Duration) Scheduler {
+	return &schedulerImpl{
+		store:        store,
+		pollInterval: pollInterval,
+		handlers:     make(map[string]Handler),
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+}
+
+// Register associates a handler with a job kind
+func (s *schedulerImpl) Register(kind string, handler Handler) {
+	s.mu.Lock()
+	s.handlers[kind] = handler
+	s.mu.Unlock()
+}
+
+// Schedule persists a job to run at runAt
+func (s *schedulerImpl) Schedule(kind string, runAt time.Time, payload interface{}) (string, error) {
+	return s.ScheduleKeyed(kind, "", runAt, payload)
+}
+
+func (s *schedulerImpl) ScheduleKeyed(kind, key string, runAt time.Time, payload interface{}) (string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("error encoding job payload: %w", err)
+	}
+
+	id, err := newJobID()
+	if err != nil {
+		return "", err
+	}
+
+	job := Job{
+		ID:        id,
+		Kind:      kind,
+		Key:       key,
+		Payload:   data,
+		RunAt:     runAt,
+		CreatedAt: time.Now(),
+	}
+
+	if err := s.store.Save(job); err != nil {
+		return "", fmt.Errorf("error saving job: %w", err)
+	}
+
+	log.Printf("Scheduled %s job %s for %s", kind, id, runAt.Format(time.RFC3339))
+	return id, nil
+}
+
+// Cancel deletes pending jobs with key. A job that is already running finishes.
+func (s *schedulerImpl) Cancel(key string) (int, error) {
+	if key == "" {
+		return 0, nil
+	}
+
+	n, err := s.store.DeleteByKey(key, time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("error cancelling jobs: %w", err)
+	}
+	if n > 0 {
+		log.Printf("Cancelled %d jobs for %s", n, key)
+	}
+	return n, nil
+}
+
+// Start begins polling. ctx is passed to job handlers so in-flight work can be
+// cancelled. Jobs left claimed by an instance that died are picked up once
+// their lease lapses; claims held by other running instances are left alone.
+func (s *schedulerImpl) Start(ctx context.Context) error {
+	ctx, s.cancel = context.WithCancel(ctx)
+	go s.run(ctx)
+	return nil
+}
+
+// Stop halts polling and waits for the current batch to finish. If ctx ends
+// first, running handlers are cancelled and their jobs are released to run again.
+func (s *schedulerImpl) Stop(ctx context.Context) {
+	close(s.stop)
+
+	select {
+	case <-s.done:
+	case <-ctx.Done():
+		log.Printf("Drain timeout reached, cancelling running jobs")
+		s.cancel()
+		<-s.done
+	}
+
+	s.cancel()
+}
+
+func (s *schedulerImpl) run(ctx context.Context) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+
+	// Pick up overdue jobs right away instead of waiting a full interval
+	s.runDue(ctx)
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.runDue(ctx)
+		}
+	}
+}
+
+func (s *schedulerImpl) runDue(ctx context.Context) {
+	jobs, err := s.store.Due(time.Now())
+	if err != nil {
+		log.Printf("Error loading due jobs: %v", err)
+		return
+	}
+
+	for _, job := range jobs {
+		if ctx.Err() != nil {
+			return
+		}
+
+		// Claiming is atomic in the store, so a job is only dispatched once
+		now := time.Now()
+		claimed, err := s.store.Claim(job.ID, now, now.Add(claimLease))
+		if err != nil {
+			log.Printf("Error claiming job %s: %v", job.ID, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		s.mu.RLock()
+		handler, ok := s.handlers[job.Kind]
+		s.mu.RUnlock()
+
+		if !ok {
+			log.Printf("No handler registered for job kind %s, dropping job %s", job.Kind, job.ID)
+		} else if err = handler(ctx, job); err != nil {
+			log.Printf("Error running %s job %s: %v", job.Kind, job.ID, err)
+		}
+
+		if ctx.Err() != nil {
+			// Release the claim so the job runs again without waiting out the lease
+			log.Printf("Job %s interrupted by shutdown, releasing it", job.ID)
+			if err := s.store.Reschedule(job.ID, job.RunAt, job.Attempts); err != nil {
+				log.Printf("Error releasing job %s: %v", job.ID, err)
+			}
+			return
+		}
+
+		if ok && err != nil && !IsPermanent(err) && job.Attempts+1 < maxAttempts {
+			runAt := time.Now().Add(retryDelay(job.Attempts + 1))
+			log.Printf("Retrying %s job %s at %s", job.Kind, job.ID, runAt.Format(time.RFC3339))
+			if err := s.store.Reschedule(job.ID, runAt, job.Attempts+1); err != nil {
+				log.Printf("Error rescheduling job %s: %v", job.ID, err)
+			}
+			continue
+		}
+		if err != nil {
+			log.Printf("Dropping %s job %s after %d attempts", job.Kind, job.ID, job.Attempts+1)
+		}
+
+		if err := s.store.Delete(job.ID); err != nil {
+			log.Printf("Error removing completed job %s: %v", job.ID, err)
+		}
+	}
+}
+
+// retryDelay returns how long to wait before the given attempt of a failed job
+func retryDelay(attempt int) time.Duration {
+	delay := retryBaseDelay << uint(attempt-1)
+	if delay <= 0 || delay > retryMaxDelay {
+		return retryMaxDelay
+	}
+	return delay
+}
+
+func newJobID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating job ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,287 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"sample-golang/pkg/database"
+	"sample-golang/pkg/docstore"
+)
+
+func newTestStore(t *testing.T) Store {
+	t.Helper()
+	backend, err := docstore.NewFileBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileBackend: %v", err)
+	}
+	return NewDocStore(backend)
+}
+
+func newSQLTestStore(t *testing.T) Store {
+	t.Helper()
+	db, err := database.Open("sqlite:" + filepath.Join(t.TempDir(), "jobs.db"))
+	if err != nil {
+		t.Fatalf("database.Open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	store, err := NewSQLStore(db)
+	if err != nil {
+		t.Fatalf("NewSQLStore: %v", err)
+	}
+	return store
+}
+
+// testStores builds each store implementation for tests of the Store contract
+var testStores = map[string]func(t *testing.T) Store{
+	"doc":    newTestStore,
+	"sqlite": newSQLTestStore,
+}
+
+func TestClaim(t *testing.T) {
+	for kind, newStore := range testStores {
+		t.Run(kind, func(t *testing.T) {
+			now := time.Now()
+
+			tests := []struct {
+				name         string
+				claimedUntil time.Time
+				want         bool
+			}{
+				{"unclaimed", time.Time{}, true},
+				{"live lease held by another instance", now.Add(time.Minute), false},
+				{"lapsed lease", now.Add(-time.Minute), true},
+			}
+
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					store := newStore(t)
+					if err := store.Save(Job{ID: "job", Kind: "test", RunAt: now}); err != nil {
+						t.Fatalf("Save: %v", err)
+					}
+					if !tt.claimedUntil.IsZero() {
+						if _, err := store.Claim("job", tt.claimedUntil.Add(-claimLease), tt.claimedUntil); err != nil {
+							t.Fatalf("Claim: %v", err)
+						}
+					}
+
+					got, err := store.Claim("job", now, now.Add(claimLease))
+					if err != nil {
+						t.Fatalf("Claim: %v", err)
+					}
+					if got != tt.want {
+						t.Errorf("Claim = %v, want %v", got, tt.want)
+					}
+
+					due, err := store.Due(now)
+					if err != nil {
+						t.Fatalf("Due: %v", err)
+					}
+					if len(due) != 0 {
+						t.Errorf("Due returned %d jobs while one is claimed", len(due))
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestClaimMissingJob(t *testing.T) {
+	for kind, newStore := range testStores {
+		t.Run(kind, func(t *testing.T) {
+			now := time.Now()
+			claimed, err := newStore(t).Claim("missing", now, now.Add(claimLease))
+			if err != nil {
+				t.Fatalf("Claim: %v", err)
+			}
+			if claimed {
+				t.Error("claimed a job that doesn't exist")
+			}
+		})
+	}
+}
+
+func TestRunDue(t *testing.T) {
+	errTransient := errors.New("vendor unavailable")
+
+	tests := []struct {
+		name         string
+		attempts     int
+		register     bool
+		err          error
+		wantKept     bool
+		wantAttempts int
+	}{
+		{"success removes the job", 0, true, nil, false, 0},
+		{"failure is retried", 0, true, errTransient, true, 1},
+		{"later failure is retried", 2, true, errTransient, true, 3},
+		{"last attempt drops the job", maxAttempts - 1, true, errTransient, false, 0},
+		{"permanent failure drops the job", 0, true, Permanent(errTransient), false, 0},
+		{"unknown kind drops the job", 0, false, nil, false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newTestStore(t)
+			s := NewScheduler(store, time.Hour).(*schedulerImpl)
+
+			runs := 0
+			if tt.register {
+				s.Register("test", func(ctx context.Context, job Job) error {
+					runs++
+					return tt.err
+				})
+			}
+
+			start := time.Now()
+			if err := store.Save(Job{ID: "job", Kind: "test", RunAt: start.Add(-time.Second), Attempts: tt.attempts}); err != nil {
+				t.Fatalf("Save: %v", err)
+			}
+
+			s.runDue(context.Background())
+
+			if tt.register && runs != 1 {
+				t.Errorf("handler ran %d times, want 1", runs)
+			}
+
+			// Look far ahead so a rescheduled job is found whatever its backoff
+			jobs, err := store.Due(start.Add(48 * time.Hour))
+			if err != nil {
+				t.Fatalf("Due: %v", err)
+			}
+			if kept := len(jobs) == 1; kept != tt.wantKept {
+				t.Fatalf("job kept = %v, want %v", kept, tt.wantKept)
+			}
+			if !tt.wantKept {
+				return
+			}
+
+			job := jobs[0]
+			if job.Attempts != tt.wantAttempts {
+				t.Errorf("Attempts = %d, want %d", job.Attempts, tt.wantAttempts)
+			}
+			if !job.RunAt.After(start) {
+				t.Errorf("RunAt = %s, want a retry after %s", job.RunAt, start)
+			}
+			if job.claimed(time.Now()) {
+				t.Error("rescheduled job is still claimed")
+			}
+		})
+	}
+}
+
+func TestRunDueReleasesInterruptedJob(t *testing.T) {
+	store := newTestStore(t)
+	s := NewScheduler(store, time.Hour).(*schedulerImpl)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.Register("test", func(ctx context.Context, job Job) error {
+		cancel()
+		return ctx.Err()
+	})
+
+	runAt := time.Now().Add(-time.Second)
+	if err := store.Save(Job{ID: "job", Kind: "test", RunAt: runAt}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	s.runDue(ctx)
+
+	jobs, err := store.Due(time.Now())
+	if err != nil {
+		t.Fatalf("Due: %v", err)
+	}
+	if len(jobs) != 1 {
+		t.Fatalf("got %d due jobs, want the interrupted job back", len(jobs))
+	}
+	if jobs[0].Attempts != 0 {
+		t.Errorf("Attempts = %d, an interrupted run shouldn't count", jobs[0].Attempts)
+	}
+}
+
+func TestDeleteByKeySkipsClaimedJobs(t *testing.T) {
+	for kind, newStore := range testStores {
+		t.Run(kind, func(t *testing.T) {
+			store := newStore(t)
+			now := time.Now()
+
+			for _, id := range []string{"pending", "running"} {
+				if err := store.Save(Job{ID: id, Kind: "test", Key: "contact", RunAt: now}); err != nil {
+					t.Fatalf("Save: %v", err)
+				}
+			}
+			if _, err := store.Claim("running", now, now.Add(claimLease)); err != nil {
+				t.Fatalf("Claim: %v", err)
+			}
+
+			deleted, err := store.DeleteByKey("contact", now)
+			if err != nil {
+				t.Fatalf("DeleteByKey: %v", err)
+			}
+			if deleted != 1 {
+				t.Errorf("deleted %d jobs, want only the unclaimed one", deleted)
+			}
+		})
+	}
+}
+
+func TestRewriteSkipsClaimedJobs(t *testing.T) {
+	for kind, newStore := range testStores {
+		t.Run(kind, func(t *testing.T) {
+			store := newStore(t)
+			now := time.Now()
+
+			for _, id := range []string{"pending", "running"} {
+				if err := store.Save(Job{ID: id, Kind: "test", Key: "old", Payload: []byte(`"old"`), RunAt: now}); err != nil {
+					t.Fatalf("Save: %v", err)
+				}
+			}
+			if _, err := store.Claim("running", now, now.Add(claimLease)); err != nil {
+				t.Fatalf("Claim: %v", err)
+			}
+
+			for id, want := range map[string]bool{"pending": true, "running": false, "missing": false} {
+				rewritten, err := store.Rewrite(id, "new", []byte(`"new"`), now)
+				if err != nil || rewritten != want {
+					t.Errorf("Rewrite(%s) = %v, %v, want %v", id, rewritten, err, want)
+				}
+			}
+
+			jobs, err := store.List()
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			if len(jobs) != 2 {
+				t.Fatalf("listed %d jobs, want 2", len(jobs))
+			}
+			for _, job := range jobs {
+				wantKey := map[string]string{"pending": "new", "running": "old"}[job.ID]
+				if job.Key != wantKey || string(job.Payload) != `"`+wantKey+`"` {
+					t.Errorf("job %s = %s %s, want key and payload %q", job.ID, job.Key, job.Payload, wantKey)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{4, 8 * time.Minute},
+		{7, time.Hour},
+		{100, time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := retryDelay(tt.attempt); got != tt.want {
+			t.Errorf("retryDelay(%d) = %s, want %s", tt.attempt, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package scheduler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+type sqlStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore creates a store backed by a SQL database shared by every
+// instance. The queries use numbered placeholders and integer timestamps so
+// the same schema works on both Postgres and SQLite; open the database with the
+// database package, which registers both drivers.
+func NewSQLStore(db *sql.DB) (Store, error) {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS scheduled_jobs (
+		id TEXT PRIMARY KEY,
+		kind TEXT NOT NULL,
+		job_key TEXT NOT NULL DEFAULT '',
+		payload TEXT NOT NULL,
+		run_at BIGINT NOT NULL,
+		claimed_until BIGINT NOT NULL DEFAULT 0,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		created_at BIGINT NOT NULL
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("error creating scheduled_jobs table: %w", err)
+	}
+
+	// Tables created by earlier versions need newer columns added
+	columns := []struct{ name, definition string }{
+		{"job_key", "TEXT NOT NULL DEFAULT ''"},
+		{"claimed_until", "BIGINT NOT NULL DEFAULT 0"},
+		{"attempts", "INTEGER NOT NULL DEFAULT 0"},
+	}
+	for _, column := range columns {
+		if _, err := db.Exec(`SELECT ` + column.name + ` FROM scheduled_jobs WHERE 1 = 0`); err == nil {
+			continue
+		}
+		if _, err := db.Exec(`ALTER TABLE scheduled_jobs ADD COLUMN ` + column.name + ` ` + column.definition); err != nil {
+			return nil, fmt.Errorf("error adding %s column: %w", column.name, err)
+		}
+	}
+
+	return &sqlStore{db: db}, nil
+}
+
+func (s *sqlStore) Save(job Job) error {
+	_, err := s.db.Exec(
+		`INSERT INTO scheduled_jobs (id, kind, job_key, payload, run_at, claimed_until, attempts, created_at) VALUES ($1, $2, $3, $4, $5, 0, $6, $7)`,
+		job.ID, job.Kind, job.Key, string(job.Payload), job.RunAt.Unix(), job.Attempts, job.CreatedAt.Unix(),
+	)
+	if err != nil {
+		return fmt.Errorf("error inserting job: %w", err)
+	}
+	return nil
+}
+
+func (s *sqlStore) Due(now time.Time) ([]Job, error) {
+	return s.query(
+		`SELECT id, kind, job_key, payload, run_at, attempts, created_at FROM scheduled_jobs WHERE claimed_until <= $1 AND run_at <= $1 ORDER BY run_at`,
+		now.Unix(),
+	)
+}
+
+func (s *sqlStore) List() ([]Job, error) {
+	return s.query(`SELECT id, kind, job_key, payload, run_at, attempts, created_at FROM scheduled_jobs ORDER BY run_at`)
+}
+
+// query reads the jobs selected by a query returning Job columns in order
+func (s *sqlStore) query(query string, args ...interface{}) ([]Job, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []Job
+	for rows.Next() {
+		var job Job
+		var payload string
+		var runAt, createdAt int64
+
+		if err := rows.Scan(&job.ID, &job.Kind, &job.Key, &payload, &runAt, &job.Attempts, &createdAt); err != nil {
+			return nil, fmt.Errorf("error scanning job: %w", err)
+		}
+
+		job.Payload = []byte(payload)
+		job.RunAt = time.Unix(runAt, 0)
+		job.CreatedAt = time.Unix(createdAt, 0)
+		jobs = append(jobs, job)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+func (s *sqlStore) Claim(id string, now, leaseUntil time.Time) (bool, error) {
+	// The conditional update makes the claim atomic across instances
+	res, err := s.db.Exec(
+		`UPDATE scheduled_jobs SET claimed_until = $2 WHERE id = $1 AND claimed_until <= $3`,
+		id, leaseUntil.Unix(), now.Unix(),
+	)
+	if err != nil {
+		return false, fmt.Errorf("error claiming job: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error claiming job: %w", err)
+	}
+	return n == 1, nil
+}
+
+func (s *sqlStore) Reschedule(id string, runAt time.Time, attempts int) error {
+	_, err := s.db.Exec(
+		`UPDATE scheduled_jobs SET run_at = $2, attempts = $3, claimed_until = 0 WHERE id = $1`,
+		id, runAt.Unix(), attempts,
+	)
+	if err != nil {
+		return fmt.Errorf("error rescheduling job: %w", err)
+	}
+	return nil
+}
+
+func (s *sqlStore) Delete(id string) error {
+	if _, err := s.db.Exec(`DELETE FROM scheduled_jobs WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("error deleting job: %w", err)
+	}
+	return nil
+}
+
+func (s *sqlStore) DeleteByKey(key string, now time.Time) (int, error) {
+	res, err := s.db.Exec(`DELETE FROM scheduled_jobs WHERE job_key = $1 AND claimed_until <= $2`, key, now.Unix())
+	if err != nil {
+		return 0, fmt.Errorf("error deleting jobs: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error deleting jobs: %w", err)
+	}
+	return int(n), nil
+}
+
+func (s *sqlStore) Rewrite(id, key string, payload json.RawMessage, now time.Time) (bool, error) {
+	res, err := s.db.Exec(
+		`UPDATE scheduled_jobs SET job_key = $2, payload = $3 WHERE id = $1 AND claimed_until <= $4`,
+		id, key, string(payload), now.Unix(),
+	)
+	if err != nil {
+		return false, fmt.Errorf("error rewriting job: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error rewriting job: %w", err)
+	}
+	return n == 1, nil
+}
@@ -0,0 +1,143 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"sample-golang/pkg/docstore"
+)
+
+// Store defines the interface for persisting scheduled jobs
+type Store interface {
+	Save(job Job) error
+	// Due returns jobs to run by now that no instance holds a live claim on
+	Due(now time.Time) ([]Job, error)
+	// Claim leases a job until leaseUntil, failing if another claim is still live at now
+	Claim(id string, now, leaseUntil time.Time) (bool, error)
+	// Reschedule releases a claimed job to run again at runAt
+	Reschedule(id string, runAt time.Time, attempts int) error
+	Delete(id string) error
+	// DeleteByKey removes jobs with key that aren't claimed at now
+	DeleteByKey(key string, now time.Time) (int, error)
+	// List returns every job, for maintenance such as migrations
+	List() ([]Job, error)
+	// Rewrite replaces the key and payload of a job that isn't claimed at now,
+	// reporting whether it did
+	Rewrite(id, key string, payload json.RawMessage, now time.Time) (bool, error)
+}
+
+type docStore struct {
+	jobs docstore.Collection[Job]
+}
+
+// NewDocStore creates a store that keeps jobs in the "jobs" collection of a
+// document backend. It reads every job to find due ones, so it suits local
+// development with the file backend; deployments use the SQL store.
+func NewDocStore(backend docstore.Backend) Store {
+	return &docStore{jobs: docstore.NewCollection[Job](backend, "jobs")}
+}
+
+func (s *docStore) Save(job Job) error {
+	return s.jobs.Put(job.ID, job)
+}
+
+func (s *docStore) Due(now time.Time) ([]Job, error) {
+	jobs, err := s.jobs.List("")
+	if err != nil {
+		return nil, err
+	}
+
+	var due []Job
+	for _, job := range jobs {
+		if !job.claimed(now) && !job.RunAt.After(now) {
+			due = append(due, job)
+		}
+	}
+
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].RunAt.Before(due[j].RunAt)
+	})
+	return due, nil
+}
+
+func (s *docStore) Claim(id string, now, leaseUntil time.Time) (bool, error) {
+	claimed := false
+	err := s.jobs.Update(id, func(job *Job, exists bool) (bool, error) {
+		if !exists || job.claimed(now) {
+			return false, nil
+		}
+		job.ClaimedUntil = leaseUntil
+		claimed = true
+		return true, nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return claimed, nil
+}
+
+func (s *docStore) Reschedule(id string, runAt time.Time, attempts int) error {
+	return s.jobs.Update(id, func(job *Job, exists bool) (bool, error) {
+		if !exists {
+			return false, nil
+		}
+		job.RunAt = runAt
+		job.Attempts = attempts
+		job.ClaimedUntil = time.Time{}
+		return true, nil
+	})
+}
+
+func (s *docStore) Delete(id string) error {
+	return s.jobs.Delete(id)
+}
+
+func (s *docStore) DeleteByKey(key string, now time.Time) (int, error) {
+	jobs, err := s.jobs.List("")
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for id, job := range jobs {
+		if job.Key != key || job.claimed(now) {
+			continue
+		}
+		if err := s.jobs.Delete(id); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+func (s *docStore) List() ([]Job, error) {
+	jobs, err := s.jobs.List("")
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Job, 0, len(jobs))
+	for _, job := range jobs {
+		result = append(result, job)
+	}
+	return result, nil
+}
+
+func (s *docStore) Rewrite(id, key string, payload json.RawMessage, now time.Time) (bool, error) {
+	rewritten := false
+	err := s.jobs.Update(id, func(job *Job, exists bool) (bool, error) {
+		if !exists || job.claimed(now) {
+			return false, nil
+		}
+		job.Key = key
+		job.Payload = payload
+		rewritten = true
+		return true, nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return rewritten, nil
+}
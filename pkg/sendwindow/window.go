@@ -0,0 +1,155 @@
+package sendwindow
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Clock is a time of day, counted in minutes after midnight
+type Clock int
+
+// ParseClock reads a time of day written as "HH:MM" in 24-hour time
+func ParseClock(value string) (Clock, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", value)
+	}
+	return Clock(t.Hour()*60 + t.Minute()), nil
+}
+
+func (c Clock) String() string {
+	return fmt.Sprintf("%02d:%02d", int(c)/60, int(c)%60)
+}
+
+func (c *Clock) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("time of day must be a string such as \"09:00\": %w", err)
+	}
+
+	parsed, err := ParseClock(value)
+	if err != nil {
+		return err
+	}
+	*c = parsed
+	return nil
+}
+
+func (c Clock) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.String())
+}
+
+// Window is the part of the day messages may be sent in the recipient's local
+// time. It may wrap past midnight; a window that starts and ends at the same
+// time is always open.
+type Window struct {
+	Start Clock `json:"start"`
+	End   Clock `json:"end"`
+	// Timezone is used for recipients whose time zone can't be told from their number
+	Timezone string `json:"timezone,omitempty"`
+}
+
+func (w Window) contains(local time.Time) bool {
+	now := Clock(local.Hour()*60 + local.Minute())
+	if w.Start == w.End {
+		return true
+	}
+	if w.Start < w.End {
+		return now >= w.Start && now < w.End
+	}
+	return now >= w.Start || now < w.End
+}
+
+// Next returns t if it falls in the window in loc, or otherwise when the window next opens
+func (w Window) Next(t time.Time, loc *time.Location) time.Time {
+	local := t.In(loc)
+	if w.contains(local) {
+		return t
+	}
+
+	opens := time.Date(local.Year(), local.Month(), local.Day(), int(w.Start)/60, int(w.Start)%60, 0, 0, loc)
+	if opens.Before(local) {
+		opens = time.Date(local.Year(), local.Month(), local.Day()+1, int(w.Start)/60, int(w.Start)%60, 0, 0, loc)
+	}
+	return opens
+}
+
+// Policy decides when reminders may be sent
+type Policy interface {
+	// Next returns the earliest time at or after t that a campaign may text a
+	// recipient in timezone. An empty or unknown timezone falls back to the
+	// campaign's, then the default window's.
+	Next(campaign, timezone string, t time.Time) time.Time
+}
+
+type policyImpl struct {
+	defaults  Window
+	campaigns map[string]Window
+	zones     map[string]*time.Location
+	mu        sync.Mutex
+}
+
+// NewPolicy creates a policy using each campaign's window where it has one and defaults otherwise
+func NewPolicy(defaults Window, campaigns map[string]Window) (Policy, error) {
+	p := &policyImpl{
+		defaults:  defaults,
+		campaigns: make(map[string]Window),
+		zones:     make(map[string]*time.Location),
+	}
+
+	if _, err := p.location(defaults.Timezone); err != nil {
+		return nil, err
+	}
+	for slug, w := range campaigns {
+		if w.Timezone == "" {
+			w.Timezone = defaults.Timezone
+		}
+		if _, err := p.location(w.Timezone); err != nil {
+			return nil, fmt.Errorf("campaign %s: %w", slug, err)
+		}
+		p.campaigns[slug] = w
+	}
+	return p, nil
+}
+
+func (p *policyImpl) Next(campaign, timezone string, t time.Time) time.Time {
+	w, ok := p.campaigns[campaign]
+	if !ok {
+		w = p.defaults
+	}
+
+	loc, err := p.location(w.Timezone)
+	if timezone != "" {
+		if recipient, zoneErr := p.location(timezone); zoneErr == nil {
+			loc, err = recipient, nil
+		} else {
+			log.Printf("Falling back to the %s time zone: %v", w.Timezone, zoneErr)
+		}
+	}
+	if err != nil {
+		// Checked when the policy was created, so only reachable if tzdata went missing
+		log.Printf("Error loading send window time zone: %v", err)
+		return t
+	}
+	return w.Next(t, loc)
+}
+
+// location loads and caches a time zone
+func (p *policyImpl) location(name string) (*time.Location, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if loc, ok := p.zones[name]; ok {
+		return loc, nil
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("error loading time zone %q: %w", name, err)
+	}
+	p.zones[name] = loc
+	return loc, nil
+}
@@ -0,0 +1,120 @@
+package sendwindow
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseClock(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Clock
+		wantErr bool
+	}{
+		{"00:00", 0, false},
+		{"09:00", 9 * 60, false},
+		{"21:30", 21*60 + 30, false},
+		{"9am", 0, true},
+		{"24:00", 0, true},
+		{"", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseClock(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseClock(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseClock(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestWindowNext(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("LoadLocation: %v", err)
+	}
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, time.March, day, hour, minute, 0, 0, loc)
+	}
+
+	day := Window{Start: 9 * 60, End: 21 * 60}
+	overnight := Window{Start: 21 * 60, End: 8 * 60}
+
+	tests := []struct {
+		name   string
+		window Window
+		t      time.Time
+		want   time.Time
+	}{
+		{"inside", day, at(4, 12, 0), at(4, 12, 0)},
+		{"at opening", day, at(4, 9, 0), at(4, 9, 0)},
+		{"before opening", day, at(4, 7, 30), at(4, 9, 0)},
+		{"at closing", day, at(4, 21, 0), at(5, 9, 0)},
+		{"after closing", day, at(4, 23, 15), at(5, 9, 0)},
+		{"overnight before midnight", overnight, at(4, 22, 0), at(4, 22, 0)},
+		{"overnight after midnight", overnight, at(5, 3, 0), at(5, 3, 0)},
+		{"overnight closed", overnight, at(4, 12, 0), at(4, 21, 0)},
+		{"always open", Window{Start: 9 * 60, End: 9 * 60}, at(4, 3, 0), at(4, 3, 0)},
+		// Clocks went forward on 10 March 2024
+		{"across a DST change", day, at(9, 22, 0), at(10, 9, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Pass UTC in to check the window is applied in loc
+			got := tt.window.Next(tt.t.UTC(), loc)
+			if !got.Equal(tt.want) {
+				t.Errorf("Next(%s) = %s, want %s", tt.t, got.In(loc), tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyNext(t *testing.T) {
+	defaults := Window{Start: 9 * 60, End: 21 * 60, Timezone: "America/New_York"}
+	policy, err := NewPolicy(defaults, map[string]Window{
+		"night-owls": {Start: 12 * 60, End: 23 * 60},
+		"london":     {Start: 10 * 60, End: 18 * 60, Timezone: "Europe/London"},
+	})
+	if err != nil {
+		t.Fatalf("NewPolicy: %v", err)
+	}
+
+	// 14:00 UTC is 10:00 in New York, 07:00 in Los Angeles and 15:00 in London
+	now := time.Date(2024, time.June, 3, 14, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		campaign string
+		timezone string
+		want     time.Time
+	}{
+		{"default window open", "", "", now},
+		{"recipient zone closed", "", "America/Los_Angeles", time.Date(2024, time.June, 3, 16, 0, 0, 0, time.UTC)},
+		{"unknown recipient zone uses the campaign's", "", "Mars/Olympus_Mons", now},
+		{"campaign window inherits the default zone", "night-owls", "", time.Date(2024, time.June, 3, 16, 0, 0, 0, time.UTC)},
+		{"campaign zone", "london", "", now},
+		{"unknown campaign uses the defaults", "missing", "", now},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.Next(tt.campaign, tt.timezone, now); !got.Equal(tt.want) {
+				t.Errorf("Next = %s, want %s", got.UTC(), tt.want)
+			}
+		})
+	}
+}
+
+func TestNewPolicyRejectsUnknownZone(t *testing.T) {
+	if _, err := NewPolicy(Window{Timezone: "Nowhere/Special"}, nil); err == nil {
+		t.Error("accepted an unknown default time zone")
+	}
+	_, err := NewPolicy(Window{Timezone: "UTC"}, map[string]Window{"bad": {Timezone: "Nowhere/Special"}})
+	if err == nil {
+		t.Error("accepted an unknown campaign time zone")
+	}
+}
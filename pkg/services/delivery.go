@@ -0,0 +1,141 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"sample-golang/pkg/delivery"
+	"sample-golang/pkg/models"
+	"sample-golang/pkg/utils"
+)
+
+// TextMagic reports message status as single-letter codes
+var textMagicStatuses = map[string]delivery.Status{
+	"q": delivery.StatusQueued,
+	"s": delivery.StatusSent,
+	"a": delivery.StatusSent,
+	"b": delivery.StatusSent,
+	"d": delivery.StatusDelivered,
+	"e": delivery.StatusFailed,
+	"f": delivery.StatusFailed,
+	"j": delivery.StatusFailed,
+	"r": delivery.StatusFailed,
+	"u": delivery.StatusUnknown,
+}
+
+// statusRank orders statuses so late or duplicate callbacks can't move a message backwards
+var statusRank = map[delivery.Status]int{
+	delivery.StatusUnknown:   0,
+	delivery.StatusQueued:    1,
+	delivery.StatusSent:      2,
+	delivery.StatusDelivered: 3,
+	delivery.StatusFailed:    3,
+}
+
+// DeliveryService defines the interface for tracking outgoing message status
+type DeliveryService interface {
+	RecordSent(messageID, phoneHash, kind string) error
+	HandleDeliveryReceipt(receipt models.DeliveryReceipt) (delivery.Message, error)
+	GetMessage(id string) (delivery.Message, error)
+	ListMessages(status delivery.Status) ([]delivery.Message, error)
+}
+
+type deliveryServiceImpl struct {
+	store       delivery.Store
+	phoneHasher utils.PhoneHasher
+}
+
+// NewDeliveryService creates a new delivery tracking service
+func NewDeliveryService(store delivery.Store, phoneHasher utils.PhoneHasher) DeliveryService {
+	return &deliveryServiceImpl{
+		store:       store,
+		phoneHasher: phoneHasher,
+	}
+}
+
+// ParseDeliveryStatus converts a TextMagic status code or name to a delivery status
+func ParseDeliveryStatus(status string) delivery.Status {
+	status = strings.ToLower(strings.TrimSpace(status))
+	if s, ok := textMagicStatuses[status]; ok {
+		return s
+	}
+
+	switch delivery.Status(status) {
+	case delivery.StatusQueued, delivery.StatusSent, delivery.StatusDelivered, delivery.StatusFailed:
+		return delivery.Status(status)
+	}
+	return delivery.StatusUnknown
+}
+
+// RecordSent starts tracking a message TextMagic accepted for sending
+func (s *deliveryServiceImpl) RecordSent(messageID, phoneHash, kind string) error {
+	now := time.Now()
+	err := s.store.Update(messageID, func(msg *delivery.Message, exists bool) {
+		// A fast receipt may already have been recorded, so keep its history
+		if !exists {
+			msg.Status = delivery.StatusQueued
+		}
+		msg.ID = messageID
+		msg.PhoneHash = phoneHash
+		msg.Kind = kind
+		msg.History = append([]delivery.Event{{Status: delivery.StatusQueued, At: now}}, msg.History...)
+		msg.CreatedAt = now
+		msg.UpdatedAt = now
+	})
+	if err != nil {
+		return fmt.Errorf("error saving message %s: %w", messageID, err)
+	}
+	return nil
+}
+
+// HandleDeliveryReceipt applies a status callback to the tracked message
+func (s *deliveryServiceImpl) HandleDeliveryReceipt(receipt models.DeliveryReceipt) (delivery.Message, error) {
+	now := time.Now()
+	status := ParseDeliveryStatus(receipt.Status)
+
+	var updated delivery.Message
+	err := s.store.Update(receipt.ID, func(msg *delivery.Message, exists bool) {
+		if !exists {
+			// Receipts can arrive for messages sent outside this service, such as auto-replies
+			*msg = delivery.Message{
+				ID:        receipt.ID,
+				PhoneHash: ConsentKey(s.phoneHasher, textMagicNumber(receipt.Receiver)),
+				Status:    delivery.StatusUnknown,
+				CreatedAt: now,
+			}
+		}
+
+		msg.History = append(msg.History, delivery.Event{
+			Status:    status,
+			ErrorCode: receipt.ErrorCode,
+			At:        now,
+		})
+
+		if statusRank[status] >= statusRank[msg.Status] {
+			msg.Status = status
+			msg.ErrorCode = receipt.ErrorCode
+		}
+		msg.UpdatedAt = now
+		updated = *msg
+	})
+	if err != nil {
+		return delivery.Message{}, fmt.Errorf("error saving message %s: %w", receipt.ID, err)
+	}
+
+	if status == delivery.StatusFailed {
+		log.Printf("Message %s to %s failed with code %q", updated.ID, updated.PhoneHash, receipt.ErrorCode)
+	}
+	return updated, nil
+}
+
+// GetMessage returns the tracked state of a message
+func (s *deliveryServiceImpl) GetMessage(id string) (delivery.Message, error) {
+	return s.store.Get(id)
+}
+
+// ListMessages returns tracked messages, optionally filtered by status
+func (s *deliveryServiceImpl) ListMessages(status delivery.Status) ([]delivery.Message, error) {
+	return s.store.List(status)
+}
@@ -0,0 +1,176 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"sample-golang/pkg/clients/textmagic"
+	"sample-golang/pkg/consent"
+	"sample-golang/pkg/models"
+	"sample-golang/pkg/phone"
+	"sample-golang/pkg/retry"
+	"sample-golang/pkg/utils"
+)
+
+// Keyword is a recognized SMS command
+type Keyword string
+
+const (
+	KeywordNone  Keyword = ""
+	KeywordStop  Keyword = "STOP"
+	KeywordStart Keyword = "START"
+	KeywordHelp  Keyword = "HELP"
+)
+
+// AutoReplyMessageKind labels tracked keyword auto-replies
+const AutoReplyMessageKind = "auto_reply"
+
+// Required carrier auto-replies for each keyword
+const (
+	stopReply  = "DemocracyOS: You have been unsubscribed and will not receive more messages. Reply START to resubscribe."
+	startReply = "DemocracyOS: You have been resubscribed to registration reminders. Reply STOP to unsubscribe, HELP for help."
+	helpReply  = "DemocracyOS: Registration reminders. Msg & data rates may apply. Reply STOP to unsubscribe. Visit democracyos.com for help."
+)
+
+var keywords = map[string]Keyword{
+	"STOP":        KeywordStop,
+	"STOPALL":     KeywordStop,
+	"UNSUBSCRIBE": KeywordStop,
+	"CANCEL":      KeywordStop,
+	"END":         KeywordStop,
+	"QUIT":        KeywordStop,
+	"START":       KeywordStart,
+	"UNSTOP":      KeywordStart,
+	"YES":         KeywordStart,
+	"HELP":        KeywordHelp,
+	"INFO":        KeywordHelp,
+}
+
+// InboundMessageService defines the interface for handling SMS replies
+type InboundMessageService interface {
+	HandleInboundMessage(ctx context.Context, msg models.InboundMessage) (Keyword, error)
+}
+
+type inboundMessageServiceImpl struct {
+	textMagicClient textmagic.Client
+	consentStore    consent.Store
+	deliveryService DeliveryService
+	phoneHasher     utils.PhoneHasher
+	retryPolicy     retry.Policy
+}
+
+// NewInboundMessageService creates a new inbound message service
+func NewInboundMessageService(
+	textMagicClient textmagic.Client,
+	consentStore consent.Store,
+	deliveryService DeliveryService,
+	phoneHasher utils.PhoneHasher,
+) InboundMessageService {
+	return &inboundMessageServiceImpl{
+		textMagicClient: textMagicClient,
+		consentStore:    consentStore,
+		deliveryService: deliveryService,
+		phoneHasher:     phoneHasher,
+		retryPolicy:     retry.DefaultPolicy,
+	}
+}
+
+// ParseKeyword returns the keyword a message consists of, ignoring case and punctuation
+func ParseKeyword(text string) Keyword {
+	word := strings.ToUpper(strings.TrimSpace(text))
+	word = strings.Trim(word, ".!?")
+	return keywords[word]
+}
+
+// ConsentKey returns the keyed phone hash used to track opt-out state
+func ConsentKey(hasher utils.PhoneHasher, raw string) string {
+	return hasher.Hash(consentNumber(raw))
+}
+
+// consentNumber normalizes raw for hashing, keeping it as is if it can't be
+// parsed so repeated messages from the number still line up
+func consentNumber(raw string) string {
+	number, err := phone.Normalize(raw)
+	if err != nil {
+		return raw
+	}
+	return number
+}
+
+// textMagicNumber converts a number TextMagic reports as international digits to E.164
+func textMagicNumber(digits string) string {
+	number, err := phone.FromDigits(digits)
+	if err != nil {
+		return digits
+	}
+	return number
+}
+
+// HandleInboundMessage records opt-out changes and sends the matching auto-reply
+func (s *inboundMessageServiceImpl) HandleInboundMessage(ctx context.Context, msg models.InboundMessage) (Keyword, error) {
+	keyword := ParseKeyword(msg.Text)
+	number := consentNumber(textMagicNumber(msg.Sender))
+	phoneHash := s.phoneHasher.Hash(number)
+
+	var reply string
+	switch keyword {
+	case KeywordStop:
+		if err := s.setOptedOut(number, true); err != nil {
+			return keyword, fmt.Errorf("error recording opt-out: %w", err)
+		}
+		log.Printf("Recorded opt-out for %s", phoneHash)
+		reply = stopReply
+	case KeywordStart:
+		if err := s.setOptedOut(number, false); err != nil {
+			return keyword, fmt.Errorf("error recording opt-in: %w", err)
+		}
+		log.Printf("Recorded opt-in for %s", phoneHash)
+		reply = startReply
+	case KeywordHelp:
+		reply = helpReply
+	default:
+		log.Printf("Received message %s from %s with no keyword", msg.ID, phoneHash)
+		return keyword, nil
+	}
+
+	var messageID string
+	err := s.retryPolicy.DoNonIdempotent(ctx, "TextMagic auto-reply", func() error {
+		callCtx, cancel := context.WithTimeout(ctx, vendorCallTimeout)
+		defer cancel()
+
+		var err error
+		messageID, err = s.textMagicClient.SendMessageToPhone(callCtx, msg.Sender, reply)
+		return err
+	})
+	if err != nil {
+		// The consent change is already saved, so don't ask TextMagic to redeliver
+		log.Printf("Error sending %s auto-reply to %s: %v", keyword, phoneHash, err)
+		return keyword, nil
+	}
+
+	if err := s.deliveryService.RecordSent(messageID, phoneHash, AutoReplyMessageKind); err != nil {
+		log.Printf("Error tracking auto-reply %s: %v", messageID, err)
+	}
+	return keyword, nil
+}
+
+// setOptedOut records the state under the current hash and drops records kept
+// under older ones, so a START can't be overridden by an earlier STOP
+func (s *inboundMessageServiceImpl) setOptedOut(number string, optedOut bool) error {
+	current := s.phoneHasher.Hash(number)
+	if err := s.consentStore.SetOptedOut(current, optedOut); err != nil {
+		return err
+	}
+
+	for _, old := range s.phoneHasher.Candidates(number) {
+		if old == current {
+			continue
+		}
+		if err := s.consentStore.Delete(old); err != nil {
+			return err
+		}
+	}
+	return nil
+}
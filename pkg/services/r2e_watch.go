@@ -0,0 +1,379 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"sample-golang/pkg/campaign"
+	"sample-golang/pkg/clients/airtable"
+)
+
+var (
+	ErrInvalidNotification = errors.New("invalid webhook notification")
+	ErrUnknownWebhook      = errors.New("unknown webhook")
+	ErrInvalidSignature    = errors.New("invalid webhook signature")
+)
+
+const (
+	// Airtable webhooks expire after seven days unless refreshed
+	r2eWebhookRefreshInterval = 24 * time.Hour
+
+	// r2eWebhookPollInterval is how often payloads are read without a
+	// notification, so a missed notification only delays them
+	r2eWebhookPollInterval = 5 * time.Minute
+
+	// r2eWebhookStaleAfter is how long after the last complete read a table
+	// stops counting as watched, and reminders check Airtable again
+	r2eWebhookStaleAfter = 3 * r2eWebhookPollInterval
+)
+
+// R2EWatchService defines the interface for learning about new R2E records from
+// Airtable webhooks instead of polling the table before every reminder
+type R2EWatchService interface {
+	// Start subscribes to each campaign's R2E table and keeps the webhooks
+	// alive until ctx is done
+	Start(ctx context.Context)
+	// HandleNotification verifies a notification and reads the webhook's new
+	// payloads
+	HandleNotification(ctx context.Context, body []byte, mac string) error
+	// Watching reports whether a live webhook covers table and its payloads
+	// were read recently, so new records are already in the registration store
+	Watching(table string) bool
+}
+
+type r2eWatchServiceImpl struct {
+	airtableClient  airtable.Client
+	store           R2EWebhookStore
+	registrations   RegistrationService
+	campaigns       campaign.Registry
+	notificationURL string
+	hashField       string
+
+	// mu serializes reading payloads so a cursor is never used twice
+	mu sync.Mutex
+}
+
+// NewR2EWatchService creates a new R2E watcher. Airtable posts notifications to
+// notificationURL; with it empty the watcher is disabled and reminders keep
+// checking Airtable directly. hashField names the R2E column holding phone hashes.
+func NewR2EWatchService(
+	airtableClient airtable.Client,
+	store R2EWebhookStore,
+	registrations RegistrationService,
+	campaigns campaign.Registry,
+	notificationURL string,
+	hashField string,
+) R2EWatchService {
+	return &r2eWatchServiceImpl{
+		airtableClient:  airtableClient,
+		store:           store,
+		registrations:   registrations,
+		campaigns:       campaigns,
+		notificationURL: notificationURL,
+		hashField:       hashField,
+	}
+}
+
+func (s *r2eWatchServiceImpl) Start(ctx context.Context) {
+	if s.notificationURL == "" {
+		log.Printf("Airtable webhook URL not set, R2E tables will be polled")
+		return
+	}
+
+	go func() {
+		s.subscribe(ctx)
+
+		refresh := time.NewTicker(r2eWebhookRefreshInterval)
+		defer refresh.Stop()
+		poll := time.NewTicker(r2eWebhookPollInterval)
+		defer poll.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-refresh.C:
+				s.subscribe(ctx)
+			case <-poll.C:
+				s.poll(ctx)
+			}
+		}
+	}()
+}
+
+// subscribe makes sure each R2E table has a live webhook, refreshing ones we
+// already have and creating the rest. Payloads missed while the service was
+// down are read from the stored cursor.
+func (s *r2eWatchServiceImpl) subscribe(ctx context.Context) {
+	hooks, err := s.store.List()
+	if err != nil {
+		log.Printf("Error loading Airtable webhooks: %v", err)
+		return
+	}
+
+	callCtx, cancel := context.WithTimeout(ctx, vendorCallTimeout)
+	remote, err := s.airtableClient.ListWebhooks(callCtx)
+	cancel()
+	if err != nil {
+		log.Printf("Error listing Airtable webhooks: %v", err)
+		return
+	}
+
+	live := make(map[string]airtable.Webhook)
+	for _, hook := range remote {
+		live[hook.ID] = hook
+	}
+
+	// Webhooks Airtable has dropped, or that point somewhere else, are replaced
+	byTable := make(map[string]R2EWebhook)
+	for _, hook := range hooks {
+		if remoteHook, ok := live[hook.ID]; ok && remoteHook.NotificationURL == s.notificationURL {
+			byTable[hook.Table] = hook
+			continue
+		}
+		if err := s.store.Delete(hook.ID); err != nil {
+			log.Printf("Error forgetting Airtable webhook %s: %v", hook.ID, err)
+		}
+	}
+
+	// Webhooks pointing here that aren't in the store may belong to another
+	// instance that created them after we listed it, so they are left alone
+	stored := make(map[string]bool)
+	for _, hook := range hooks {
+		stored[hook.ID] = true
+	}
+	for _, hook := range remote {
+		if hook.NotificationURL == s.notificationURL && !stored[hook.ID] {
+			log.Printf("Airtable webhook %s isn't in the store; leaving it in place", hook.ID)
+		}
+	}
+
+	for _, table := range s.tables() {
+		hook, ok := byTable[table]
+		if ok {
+			err = s.refresh(ctx, &hook)
+		} else {
+			hook, err = s.create(ctx, table)
+		}
+		if err != nil {
+			log.Printf("Error setting up Airtable webhook for %s: %v", table, err)
+			continue
+		}
+
+		// Catch up on anything that changed while we weren't listening
+		if err := s.readPayloads(ctx, hook.ID); err != nil {
+			log.Printf("Error reading Airtable webhook %s: %v", hook.ID, err)
+		}
+	}
+}
+
+// poll reads any payloads each stored webhook has waiting
+func (s *r2eWatchServiceImpl) poll(ctx context.Context) {
+	hooks, err := s.store.List()
+	if err != nil {
+		log.Printf("Error loading Airtable webhooks: %v", err)
+		return
+	}
+
+	for _, hook := range hooks {
+		if err := s.readPayloads(ctx, hook.ID); err != nil {
+			log.Printf("Error reading Airtable webhook %s: %v", hook.ID, err)
+		}
+	}
+}
+
+// tables returns each distinct R2E table used by a campaign
+func (s *r2eWatchServiceImpl) tables() []string {
+	seen := make(map[string]bool)
+	var tables []string
+	for _, camp := range s.campaigns.List() {
+		if camp.R2ETable == "" || seen[camp.R2ETable] {
+			continue
+		}
+		seen[camp.R2ETable] = true
+		tables = append(tables, camp.R2ETable)
+	}
+	return tables
+}
+
+func (s *r2eWatchServiceImpl) create(ctx context.Context, table string) (R2EWebhook, error) {
+	callCtx, cancel := context.WithTimeout(ctx, vendorCallTimeout)
+	defer cancel()
+
+	// Payloads refer to tables and fields by ID
+	schema, err := s.airtableClient.GetTable(callCtx, table)
+	if err != nil {
+		return R2EWebhook{}, err
+	}
+	hashFieldID := schema.FieldID(s.hashField)
+	if hashFieldID == "" {
+		return R2EWebhook{}, fmt.Errorf("table %s has no %q field", table, s.hashField)
+	}
+
+	created, err := s.airtableClient.CreateWebhook(callCtx, s.notificationURL, airtable.NewTableSpecification(schema.ID, hashFieldID))
+	if err != nil {
+		return R2EWebhook{}, err
+	}
+
+	hook := R2EWebhook{
+		ID:              created.ID,
+		Table:           table,
+		TableID:         schema.ID,
+		HashFieldID:     hashFieldID,
+		MACSecretBase64: created.MACSecretBase64,
+		Cursor:          1,
+		ExpiresAt:       created.ExpirationTime,
+	}
+	if err := s.store.Save(hook); err != nil {
+		return R2EWebhook{}, fmt.Errorf("error saving webhook %s: %w", hook.ID, err)
+	}
+	log.Printf("Created Airtable webhook %s for %s", hook.ID, table)
+	return hook, nil
+}
+
+func (s *r2eWatchServiceImpl) refresh(ctx context.Context, hook *R2EWebhook) error {
+	callCtx, cancel := context.WithTimeout(ctx, vendorCallTimeout)
+	defer cancel()
+
+	expiresAt, err := s.airtableClient.RefreshWebhook(callCtx, hook.ID)
+	if err != nil {
+		return err
+	}
+
+	// Read again so a cursor saved meanwhile isn't overwritten
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, err := s.store.Get(hook.ID)
+	if err != nil {
+		return err
+	}
+	if current != nil {
+		*hook = *current
+	}
+	hook.ExpiresAt = expiresAt
+	return s.store.Save(*hook)
+}
+
+func (s *r2eWatchServiceImpl) HandleNotification(ctx context.Context, body []byte, mac string) error {
+	var notification airtable.Notification
+	if err := json.Unmarshal(body, &notification); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidNotification, err)
+	}
+
+	hook, err := s.store.Get(notification.Webhook.ID)
+	if err != nil {
+		return err
+	}
+	if hook == nil {
+		return fmt.Errorf("%w: %s", ErrUnknownWebhook, notification.Webhook.ID)
+	}
+	if !airtable.VerifyNotification(hook.MACSecretBase64, body, mac) {
+		return ErrInvalidSignature
+	}
+
+	return s.readPayloads(ctx, hook.ID)
+}
+
+// readPayloads marks the phone hashes in new R2E records complete and moves the
+// webhook's cursor past them. A page is read again next time unless every
+// registrant in it was marked complete.
+func (s *r2eWatchServiceImpl) readPayloads(ctx context.Context, webhookID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hook, err := s.store.Get(webhookID)
+	if err != nil {
+		return fmt.Errorf("error loading webhook %s: %w", webhookID, err)
+	}
+	if hook == nil {
+		return fmt.Errorf("%w: %s", ErrUnknownWebhook, webhookID)
+	}
+
+	for {
+		callCtx, cancel := context.WithTimeout(ctx, vendorCallTimeout)
+		page, err := s.airtableClient.WebhookPayloads(callCtx, hook.ID, hook.Cursor)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("error reading payloads for webhook %s: %w", hook.ID, err)
+		}
+
+		for _, payload := range page.Payloads {
+			if err := s.markComplete(ctx, *hook, payload.ChangedTablesByID[hook.TableID]); err != nil {
+				return err
+			}
+		}
+
+		hook.Cursor = page.Cursor
+		if !page.MightHaveMore {
+			hook.ReadAt = time.Now()
+		}
+		if err := s.store.Save(*hook); err != nil {
+			return fmt.Errorf("error saving webhook %s: %w", hook.ID, err)
+		}
+
+		if !page.MightHaveMore {
+			return nil
+		}
+	}
+}
+
+func (s *r2eWatchServiceImpl) markComplete(ctx context.Context, hook R2EWebhook, changes airtable.TableChanges) error {
+	slug := s.campaignFor(hook.Table)
+	for _, value := range changes.CellValues(hook.HashFieldID) {
+		phoneHash, ok := value.(string)
+		if !ok || phoneHash == "" {
+			continue
+		}
+
+		err := s.registrations.MarkComplete(ctx, Completion{
+			PhoneHash: phoneHash,
+			Campaign:  slug,
+			Source:    "airtable",
+			Reference: hook.ID,
+			InR2E:     true,
+		})
+		if err != nil {
+			return fmt.Errorf("error marking %s complete from Airtable: %w", phoneHash, err)
+		}
+	}
+	return nil
+}
+
+// campaignFor returns the slug of a campaign using table. Campaigns sharing a
+// table share registrants, so any of them will do.
+func (s *r2eWatchServiceImpl) campaignFor(table string) string {
+	for _, camp := range s.campaigns.List() {
+		if camp.R2ETable == table {
+			return camp.Slug
+		}
+	}
+	return ""
+}
+
+func (s *r2eWatchServiceImpl) Watching(table string) bool {
+	if s.notificationURL == "" {
+		return false
+	}
+
+	// Webhooks are read by whichever instance Airtable notifies, so the
+	// shared store says how current the registration store is
+	hooks, err := s.store.List()
+	if err != nil {
+		log.Printf("Error loading Airtable webhooks: %v", err)
+		return false
+	}
+
+	now := time.Now()
+	for _, hook := range hooks {
+		if hook.Table == table && now.Before(hook.ExpiresAt) && now.Sub(hook.ReadAt) < r2eWebhookStaleAfter {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"sample-golang/pkg/docstore"
+)
+
+// R2EWebhook is what we keep about an Airtable webhook watching an R2E table.
+// Airtable only returns the MAC secret when the webhook is created.
+type R2EWebhook struct {
+	ID              string    `json:"id"`
+	Table           string    `json:"table"`
+	TableID         string    `json:"table_id"`
+	HashFieldID     string    `json:"hash_field_id"`
+	MACSecretBase64 string    `json:"mac_secret_base64"`
+	Cursor          int       `json:"cursor"`
+	ExpiresAt       time.Time `json:"expires_at"`
+	// ReadAt is when the payloads were last read through to the end
+	ReadAt time.Time `json:"read_at"`
+}
+
+// R2EWebhookStore defines the interface for persisting R2E webhooks and how
+// far through their payloads we've read
+type R2EWebhookStore interface {
+	List() ([]R2EWebhook, error)
+	// Get returns nil without an error when no webhook has the ID
+	Get(id string) (*R2EWebhook, error)
+	Save(hook R2EWebhook) error
+	Delete(id string) error
+}
+
+type r2eWebhookStoreImpl struct {
+	hooks docstore.Collection[R2EWebhook]
+}
+
+// NewR2EWebhookStore creates a store that keeps webhooks in the "airtable_webhooks" collection
+func NewR2EWebhookStore(backend docstore.Backend) R2EWebhookStore {
+	return &r2eWebhookStoreImpl{hooks: docstore.NewCollection[R2EWebhook](backend, "airtable_webhooks")}
+}
+
+func (s *r2eWebhookStoreImpl) List() ([]R2EWebhook, error) {
+	hooks, err := s.hooks.List("")
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]R2EWebhook, 0, len(hooks))
+	for _, hook := range hooks {
+		list = append(list, hook)
+	}
+	return list, nil
+}
+
+func (s *r2eWebhookStoreImpl) Get(id string) (*R2EWebhook, error) {
+	hook, err := s.hooks.Get(id)
+	if errors.Is(err, docstore.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &hook, nil
+}
+
+func (s *r2eWebhookStoreImpl) Save(hook R2EWebhook) error {
+	return s.hooks.Put(hook.ID, hook)
+}
+
+func (s *r2eWebhookStoreImpl) Delete(id string) error {
+	return s.hooks.Delete(id)
+}
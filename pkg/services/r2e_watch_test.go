@@ -0,0 +1,47 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"sample-golang/pkg/docstore"
+)
+
+func TestR2EWatchWatching(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name string
+		url  string
+		hook *R2EWebhook
+		want bool
+	}{
+		{"live and read", "https://example.com/hook", &R2EWebhook{Table: "R2E", ExpiresAt: now.Add(time.Hour), ReadAt: now}, true},
+		{"no webhook", "https://example.com/hook", nil, false},
+		{"other table", "https://example.com/hook", &R2EWebhook{Table: "Other", ExpiresAt: now.Add(time.Hour), ReadAt: now}, false},
+		{"expired", "https://example.com/hook", &R2EWebhook{Table: "R2E", ExpiresAt: now.Add(-time.Minute), ReadAt: now}, false},
+		{"stale cursor", "https://example.com/hook", &R2EWebhook{Table: "R2E", ExpiresAt: now.Add(time.Hour), ReadAt: now.Add(-r2eWebhookStaleAfter)}, false},
+		{"never read", "https://example.com/hook", &R2EWebhook{Table: "R2E", ExpiresAt: now.Add(time.Hour)}, false},
+		{"watcher disabled", "", &R2EWebhook{Table: "R2E", ExpiresAt: now.Add(time.Hour), ReadAt: now}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend, err := docstore.NewFileBackend(t.TempDir())
+			if err != nil {
+				t.Fatalf("NewFileBackend: %v", err)
+			}
+			store := NewR2EWebhookStore(backend)
+			if tt.hook != nil {
+				tt.hook.ID = "ach1"
+				if err := store.Save(*tt.hook); err != nil {
+					t.Fatalf("Save: %v", err)
+				}
+			}
+
+			watch := NewR2EWatchService(nil, store, nil, nil, tt.url, "hash")
+			if got := watch.Watching("R2E"); got != tt.want {
+				t.Errorf("Watching = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
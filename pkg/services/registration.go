@@ -0,0 +1,137 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"sample-golang/pkg/campaign"
+	"sample-golang/pkg/clients/airtable"
+	"sample-golang/pkg/registration"
+	"sample-golang/pkg/retry"
+	"sample-golang/pkg/scheduler"
+	"sample-golang/pkg/workflow"
+)
+
+// Completion describes a registrant who finished the sign-up form
+type Completion struct {
+	PhoneHash string
+	Campaign  string
+	First     string
+	Last      string
+	// Source and Reference say where we heard about it, e.g. "fillout" and the submission ID
+	Source    string
+	Reference string
+	// InR2E is set when the registrant was found in the R2E table, so there's nothing to write back
+	InR2E bool
+}
+
+// RegistrationService defines the interface for recording finished registrations
+type RegistrationService interface {
+	MarkComplete(ctx context.Context, completion Completion) error
+}
+
+type registrationServiceImpl struct {
+	store          registration.Store
+	workflows      workflow.Engine
+	scheduler      scheduler.Scheduler
+	airtableClient airtable.Client
+	campaigns      campaign.Registry
+	writeR2E       bool
+	r2eHashField   string
+	retryPolicy    retry.Policy
+}
+
+// NewRegistrationService creates a new registration service. With writeR2E set,
+// completions are also added to the campaign's R2E table if they aren't there
+// yet. r2eHashField names the R2E column holding phone hashes.
+func NewRegistrationService(
+	store registration.Store,
+	workflows workflow.Engine,
+	scheduler scheduler.Scheduler,
+	airtableClient airtable.Client,
+	campaigns campaign.Registry,
+	writeR2E bool,
+	r2eHashField string,
+) RegistrationService {
+	return &registrationServiceImpl{
+		store:          store,
+		workflows:      workflows,
+		scheduler:      scheduler,
+		airtableClient: airtableClient,
+		campaigns:      campaigns,
+		writeR2E:       writeR2E,
+		r2eHashField:   r2eHashField,
+		retryPolicy:    retry.DefaultPolicy,
+	}
+}
+
+// MarkComplete records the registration and cancels the registrant's pending
+// reminders. It is safe to call again for the same registrant.
+func (s *registrationServiceImpl) MarkComplete(ctx context.Context, completion Completion) error {
+	camp, err := s.campaigns.Get(completion.Campaign)
+	if err != nil {
+		return err
+	}
+
+	if err := s.store.MarkComplete(completion.PhoneHash, registration.Record{
+		Source:    completion.Source,
+		Reference: completion.Reference,
+	}); err != nil {
+		return fmt.Errorf("error recording registration: %w", err)
+	}
+	log.Printf("Marked %s complete from %s", completion.PhoneHash, completion.Source)
+
+	// Cancel reminder sequences and any single reminders scheduled before them
+	if err := s.workflows.Cancel(completion.PhoneHash, ""); err != nil && !errors.Is(err, workflow.ErrProgressNotFound) {
+		return fmt.Errorf("error cancelling reminders: %w", err)
+	}
+	if _, err := s.scheduler.Cancel(followupJobKey(completion.PhoneHash)); err != nil {
+		return fmt.Errorf("error cancelling reminders: %w", err)
+	}
+
+	if !s.writeR2E || completion.InR2E {
+		return nil
+	}
+
+	exists, err := s.recordExists(ctx, camp.R2ETable, completion.PhoneHash)
+	if err != nil {
+		return fmt.Errorf("error checking R2E table: %w", err)
+	}
+	if exists {
+		return nil
+	}
+
+	record := map[string]interface{}{
+		"first":        completion.First,
+		"last":         completion.Last,
+		s.r2eHashField: completion.PhoneHash,
+	}
+	if err := s.createRecord(ctx, camp.R2ETable, record); err != nil {
+		return fmt.Errorf("error creating R2E record: %w", err)
+	}
+	return nil
+}
+
+func (s *registrationServiceImpl) recordExists(ctx context.Context, table, phoneHash string) (bool, error) {
+	var exists bool
+	err := s.retryPolicy.Do(ctx, "Airtable record check", func() error {
+		callCtx, cancel := context.WithTimeout(ctx, vendorCallTimeout)
+		defer cancel()
+
+		var err error
+		exists, err = s.airtableClient.RecordExists(callCtx, table, s.r2eHashField, phoneHash)
+		return err
+	})
+	return exists, err
+}
+
+func (s *registrationServiceImpl) createRecord(ctx context.Context, table string, data map[string]interface{}) error {
+	return s.retryPolicy.DoNonIdempotent(ctx, "Airtable record creation", func() error {
+		callCtx, cancel := context.WithTimeout(ctx, vendorCallTimeout)
+		defer cancel()
+
+		return s.airtableClient.CreateRecord(callCtx, table, data)
+	})
+}
@@ -1,99 +1,198 @@
 package services
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"log"
-	"net/url"
 	"strconv"
 	"time"
 
+	"sample-golang/pkg/campaign"
 	"sample-golang/pkg/clients/airtable"
 	"sample-golang/pkg/clients/shortio"
 	"sample-golang/pkg/clients/textmagic"
-	"sample-golang/pkg/config"
+	"sample-golang/pkg/consent"
 	"sample-golang/pkg/models"
+	"sample-golang/pkg/phone"
+	"sample-golang/pkg/registration"
+	"sample-golang/pkg/retry"
+	"sample-golang/pkg/scheduler"
+	"sample-golang/pkg/sendwindow"
+	"sample-golang/pkg/templates"
+	"sample-golang/pkg/token"
 	"sample-golang/pkg/utils"
+	"sample-golang/pkg/workflow"
 )
 
+const (
+	// FollowupJobKind identifies single reminder jobs scheduled before sequences
+	FollowupJobKind = "followup"
+
+	// SubmissionJobKind identifies submissions persisted during shutdown
+	SubmissionJobKind = "landing_submission"
+
+	// vendorCallTimeout bounds each attempt at a vendor API call
+	vendorCallTimeout = 20 * time.Second
+
+	// partialHashField names the Partial table column holding phone hashes
+	partialHashField = "hash"
+)
+
+// followupPayload is the data persisted with a single scheduled reminder
+type followupPayload struct {
+	Campaign    string   `json:"campaign,omitempty"`
+	PhoneHash   string   `json:"phone_hash"`
+	PhoneHashes []string `json:"phone_hashes,omitempty"`
+	ConsentKey  string   `json:"consent_key,omitempty"`
+	FirstName   string   `json:"first_name"`
+	LastName    string   `json:"last_name"`
+	ContactID   string   `json:"contact_id"`
+}
+
 // LandingSubmissionService defines the interface for handling form submissions
 type LandingSubmissionService interface {
-	ProcessLandingSubmission(data models.LandingFormData)
+	ProcessLandingSubmission(ctx context.Context, data models.LandingFormData) error
 }
 
 type landingSubmissionServiceImpl struct {
 	textMagicClient textmagic.Client
 	airtableClient  airtable.Client
 	shortIOClient   shortio.Client
-	config          *config.Config
+	scheduler       scheduler.Scheduler
+	consentStore    consent.Store
+	registrations   registration.Store
+	deliveryService DeliveryService
+	phoneHasher     utils.PhoneHasher
+	tokens          token.Service
+	campaigns       campaign.Registry
+	workflows       workflow.Engine
+	templates       templates.Library
+	sendWindow      sendwindow.Policy
+	r2eWatch        R2EWatchService
+	r2eHashField    string
+	retryPolicy     retry.Policy
 }
 
-// NewLandingSubmissionService creates a new submission service
+// NewLandingSubmissionService creates a new submission service. r2eHashField
+// names the R2E column holding phone hashes.
 func NewLandingSubmissionService(
 	textMagicClient textmagic.Client,
 	airtableClient airtable.Client,
 	shortIOClient shortio.Client,
-	config *config.Config,
+	scheduler scheduler.Scheduler,
+	consentStore consent.Store,
+	registrations registration.Store,
+	deliveryService DeliveryService,
+	phoneHasher utils.PhoneHasher,
+	tokens token.Service,
+	campaigns campaign.Registry,
+	workflows workflow.Engine,
+	templates templates.Library,
+	sendWindow sendwindow.Policy,
+	r2eWatch R2EWatchService,
+	r2eHashField string,
 ) LandingSubmissionService {
-	return &landingSubmissionServiceImpl{
+	s := &landingSubmissionServiceImpl{
 		textMagicClient: textMagicClient,
 		airtableClient:  airtableClient,
 		shortIOClient:   shortIOClient,
-		config:          config,
+		scheduler:       scheduler,
+		consentStore:    consentStore,
+		registrations:   registrations,
+		deliveryService: deliveryService,
+		phoneHasher:     phoneHasher,
+		tokens:          tokens,
+		campaigns:       campaigns,
+		workflows:       workflows,
+		templates:       templates,
+		sendWindow:      sendWindow,
+		r2eWatch:        r2eWatch,
+		r2eHashField:    r2eHashField,
+		retryPolicy:     retry.DefaultPolicy,
 	}
+
+	workflows.SetRunner(reminderRunner{s})
+	scheduler.Register(FollowupJobKind, s.runFollowup)
+	scheduler.Register(SubmissionJobKind, s.runSubmission)
+	return s
 }
 
-// ProcessLandingSubmission handles the entire submission workflow
-func (s *landingSubmissionServiceImpl) ProcessLandingSubmission(data models.LandingFormData) {
-	// Hash the phone number
-	phoneHash := utils.HashString(data.Phone)
+// ProcessLandingSubmission handles the entire submission workflow. It is safe
+// to run again for a submission that was interrupted part way through.
+func (s *landingSubmissionServiceImpl) ProcessLandingSubmission(ctx context.Context, data models.LandingFormData) error {
+	// Submissions persisted before numbers were normalized at the handler still need it
+	number, err := phone.Normalize(data.Phone)
+	if err != nil {
+		return err
+	}
+	data.Phone = number
+
+	camp, err := s.campaigns.Get(data.Campaign)
+	if err != nil {
+		return err
+	}
+
+	// Hash the phone number, matching records written under any active key
+	phoneHash := s.phoneHasher.Hash(data.Phone)
+	phoneHashes := s.phoneHasher.Candidates(data.Phone)
 
-	log.Printf("Processing submission for %s %s (%s)", data.First, data.Last, phoneHash)
+	log.Printf("Processing %s submission for %s %s (%s)", camp.Slug, data.First, data.Last, phoneHash)
 
 	// Get or create TextMagic contact
-	textMagicContactID, err := s.textMagicClient.GetOrCreateContact(data.Phone, data.First, data.Last)
+	textMagicContactID, err := s.getOrCreateContact(ctx, data.Phone, data.First, data.Last, camp.TextMagicList)
 	if err != nil {
-		log.Printf("Error with TextMagic API: %v", err)
-		return
+		return fmt.Errorf("error with TextMagic API: %w", err)
 	}
 
 	// Check if record exists in Partial table
-	existsInPartial, err := s.airtableClient.RecordExists(s.config.AirtablePartialTable, phoneHash)
+	existsInPartial, err := s.recordExists(ctx, camp.PartialTable, partialHashField, phoneHashes)
 	if err != nil {
-		log.Printf("Error checking Partial table: %v", err)
-		return
+		return fmt.Errorf("error checking Partial table: %w", err)
 	}
 
 	// Check if record exists in R2E table
-	existsInR2E, err := s.airtableClient.RecordExists(s.config.AirtableR2ETable, phoneHash)
+	existsInR2E, err := s.recordExists(ctx, camp.R2ETable, s.r2eHashField, phoneHashes)
 	if err != nil {
-		log.Printf("Error checking R2E table: %v", err)
-		return
+		return fmt.Errorf("error checking R2E table: %w", err)
 	}
 
 	if !existsInPartial && !existsInR2E {
 		// Parse the TextMagic contact ID as an integer for Airtable
 		contactIDInt, err := strconv.ParseInt(textMagicContactID, 10, 64)
 		if err != nil {
-			log.Printf("Error converting contact ID to number: %v", err)
-			return
+			return fmt.Errorf("error converting contact ID to number: %w", err)
 		}
 
 		// Create new record in partial
 		record := map[string]interface{}{
-			"first":      data.First,
-			"last":       data.Last,
-			"phone":      data.Phone,
-			"hash":       phoneHash,
-			"Contact ID": contactIDInt, // Sending as integer, not string
+			"first":          data.First,
+			"last":           data.Last,
+			"phone":          data.Phone,
+			partialHashField: phoneHash,
+			"Contact ID":     contactIDInt, // Sending as integer, not string
 		}
 
-		if err := s.airtableClient.CreateRecord(s.config.AirtablePartialTable, record); err != nil {
-			log.Printf("Error creating Airtable record: %v", err)
-			return
+		// Start the campaign's reminder sequence, which survives restarts,
+		// before the record: a retry skips contacts already in the Partial
+		// table, while starting a sequence twice does nothing
+		err = s.scheduleFollowup(camp, workflow.Contact{
+			Key:         phoneHash,
+			Campaign:    camp.Slug,
+			PhoneHashes: phoneHashes,
+			ConsentKey:  ConsentKey(s.phoneHasher, data.Phone),
+			Timezone:    phone.TimeZone(data.Phone),
+			FirstName:   data.First,
+			LastName:    data.Last,
+			ContactID:   textMagicContactID,
+		})
+		if err != nil {
+			return err
 		}
 
-		// Set timer
-		go s.scheduleFollowup(phoneHash, data.First, data.Last, textMagicContactID)
+		if err := s.createRecord(ctx, camp.PartialTable, record); err != nil {
+			return fmt.Errorf("error creating Airtable record: %w", err)
+		}
 
 	} else if existsInPartial && existsInR2E {
 		log.Printf("Skipping processing for %s as they already exist in both R2E and Partial tables", phoneHash)
@@ -102,44 +201,295 @@ func (s *landingSubmissionServiceImpl) ProcessLandingSubmission(data models.Land
 	} else if existsInR2E {
 		log.Printf("Skipping processing for %s as they already exist in the R2E table", phoneHash)
 	}
+
+	return nil
 }
 
-// scheduleFollowup waits 15 minutes then checks if the user needs a followup message
-func (s *landingSubmissionServiceImpl) scheduleFollowup(phoneHash, firstName, lastName, contactID string) {
-	log.Printf("Setting timer for %s", phoneHash)
-	// Wait for 15 minutes
-	time.Sleep(15 * time.Minute)
+// runSubmission processes a submission that was persisted during shutdown
+func (s *landingSubmissionServiceImpl) runSubmission(ctx context.Context, job scheduler.Job) error {
+	var data models.LandingFormData
+	if err := json.Unmarshal(job.Payload, &data); err != nil {
+		return scheduler.Permanent(fmt.Errorf("error decoding submission payload: %w", err))
+	}
 
-	// Check if record exists in R2E table
-	existsInR2E, err := s.airtableClient.RecordExists(s.config.AirtableR2ETable, phoneHash)
+	return s.ProcessLandingSubmission(ctx, data)
+}
+
+// scheduleFollowup starts the campaign's reminder sequence for a new registrant
+func (s *landingSubmissionServiceImpl) scheduleFollowup(camp campaign.Campaign, contact workflow.Contact) error {
+	if s.isOptedOut(contact.ConsentKey, contact.PhoneHashes) {
+		log.Printf("Not scheduling followup for %s as they have opted out", contact.Key)
+		return nil
+	}
+
+	log.Printf("Starting sequence %s for %s", camp.SequenceName(), contact.Key)
+
+	if err := s.workflows.Start(camp.SequenceName(), contact); err != nil {
+		return fmt.Errorf("error starting followup sequence: %w", err)
+	}
+	return nil
+}
+
+// runFollowup sends a single reminder scheduled before sequences, if still needed
+func (s *landingSubmissionServiceImpl) runFollowup(ctx context.Context, job scheduler.Job) error {
+	var payload followupPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return scheduler.Permanent(fmt.Errorf("error decoding followup payload: %w", err))
+	}
+
+	// Reminders scheduled before keyed hashes only carry the one hash
+	if len(payload.PhoneHashes) == 0 {
+		payload.PhoneHashes = []string{payload.PhoneHash}
+	}
+
+	// The contact may have replied STOP since the reminder was scheduled
+	if s.isOptedOut(payload.ConsentKey, payload.PhoneHashes) {
+		log.Printf("Skipping message for %s as they have opted out", payload.PhoneHash)
+		return nil
+	}
+
+	// Reminders scheduled before campaigns existed belong to the default campaign
+	camp, err := s.campaigns.Get(payload.Campaign)
+	if err != nil {
+		return scheduler.Permanent(err)
+	}
+
+	// These reminders don't record the contact's time zone, so go by the campaign's
+	now := time.Now()
+	if next := s.sendWindow.Next(camp.Slug, "", now); next.After(now) {
+		log.Printf("Deferring reminder for %s to %s", payload.PhoneHash, next.Format(time.RFC3339))
+		if _, err := s.scheduler.ScheduleKeyed(FollowupJobKind, followupJobKey(payload.PhoneHash), next, payload); err != nil {
+			return fmt.Errorf("error deferring followup: %w", err)
+		}
+		return nil
+	}
+
+	s.sendFollowup(ctx, camp, payload)
+	return nil
+}
+
+// followupJobKey identifies a contact's single reminder jobs so they can be cancelled
+func followupJobKey(phoneHash string) string {
+	return FollowupJobKind + "/" + phoneHash
+}
+
+// isRegistered reports whether the contact is in the R2E table, checking our
+// own record of finished registrations before asking Airtable. While a live
+// webhook that has been read recently covers the table, new records are
+// already in our own record; otherwise a contact we haven't recorded is
+// looked up.
+func (s *landingSubmissionServiceImpl) isRegistered(ctx context.Context, camp campaign.Campaign, phoneHashes []string) (bool, error) {
+	complete, err := s.registrations.IsComplete(phoneHashes...)
+	if err != nil {
+		log.Printf("Error checking registrations: %v", err)
+	} else if complete || s.r2eWatch.Watching(camp.R2ETable) {
+		return complete, nil
+	}
+
+	return s.recordExists(ctx, camp.R2ETable, s.r2eHashField, phoneHashes)
+}
+
+// isOptedOut reports whether the contact has replied STOP. Opt-outs recorded
+// before consent keys were keyed are found under the contact's older hashes.
+// Lookup failures are treated as opted out so we never message someone we
+// can't confirm.
+func (s *landingSubmissionServiceImpl) isOptedOut(consentKey string, phoneHashes []string) bool {
+	keys := phoneHashes
+	if consentKey != "" {
+		keys = append([]string{consentKey}, phoneHashes...)
+	}
+	if len(keys) == 0 {
+		return false
+	}
+
+	optedOut, err := s.consentStore.IsOptedOut(keys...)
+	if err != nil {
+		log.Printf("Error checking opt-out state for %s: %v", consentKey, err)
+		return true
+	}
+	return optedOut
+}
+
+// sendFollowup sends the reminder unless the user already finished registering
+func (s *landingSubmissionServiceImpl) sendFollowup(ctx context.Context, camp campaign.Campaign, payload followupPayload) {
+	// Check if the user finished registering
+	existsInR2E, err := s.isRegistered(ctx, camp, payload.PhoneHashes)
 	if err != nil {
 		log.Printf("Error checking second Airtable table: %v", err)
 		return
 	}
 
 	if !existsInR2E {
-		// Create Short.io link
-		params := url.Values{}
-		params.Add("first", firstName)
-		params.Add("last", lastName)
-		params.Add("id", phoneHash)
-
-		targetURL := fmt.Sprintf("https://forms.democracyOS.com/t/bj1RaePxL2us?%s", params.Encode())
-		shortLink, err := s.shortIOClient.CreateShortLink(targetURL)
+		contact := workflow.Contact{
+			Key:       payload.PhoneHash,
+			FirstName: payload.FirstName,
+			LastName:  payload.LastName,
+			ContactID: payload.ContactID,
+		}
+		if err := s.sendReminder(ctx, camp, camp.ReminderMessage, contact); err != nil {
+			log.Printf("Error sending reminder: %v", err)
+		}
+	} else {
+		log.Printf("Skipping message for %s as they already exist in the R2E table", payload.PhoneHash)
+	}
+}
+
+// sendReminder sends template with a freshly signed form link and tracks its delivery
+func (s *landingSubmissionServiceImpl) sendReminder(ctx context.Context, camp campaign.Campaign, template string, contact workflow.Contact) error {
+	// Sign the registrant's details into the link so it can't be edited
+	params, err := s.tokens.LinkParams(token.Claims{
+		First:     contact.FirstName,
+		Last:      contact.LastName,
+		PhoneHash: contact.Key,
+		Campaign:  camp.Slug,
+	})
+	if err != nil {
+		return fmt.Errorf("error issuing reminder token: %w", err)
+	}
+
+	// Create Short.io link
+	targetURL := fmt.Sprintf("%s?%s", camp.ReminderFormURL, params.Encode())
+	shortLink, err := s.createShortLink(ctx, targetURL)
+	if err != nil {
+		return fmt.Errorf("error creating short link: %w", err)
+	}
+
+	message, err := s.templates.Render(camp.Slug, template, templates.Data{
+		First:    contact.FirstName,
+		Last:     contact.LastName,
+		Link:     shortLink,
+		Town:     camp.Name,
+		Campaign: camp.Slug,
+	})
+	if err != nil {
+		return err
+	}
+	for _, warning := range message.Warnings {
+		log.Printf("Reminder for %s: %s", contact.Key, warning)
+	}
+
+	// Send message via TextMagic
+	messageID, err := s.sendMessage(ctx, contact.ContactID, message.Text)
+	if err != nil {
+		return fmt.Errorf("error sending message: %w", err)
+	}
+
+	if err := s.deliveryService.RecordSent(messageID, contact.Key, FollowupJobKind); err != nil {
+		log.Printf("Error tracking message %s: %v", messageID, err)
+	}
+
+	log.Printf("Successfully sent reminder to %s %s", contact.FirstName, contact.LastName)
+	return nil
+}
+
+// reminderRunner runs the steps of reminder sequences
+type reminderRunner struct {
+	s *landingSubmissionServiceImpl
+}
+
+// Check ends the sequence for contacts who opted out and evaluates step conditions
+func (r reminderRunner) Check(ctx context.Context, condition string, contact workflow.Contact) (bool, error) {
+	// The contact may have replied STOP since the sequence started
+	if r.s.isOptedOut(contact.ConsentKey, contact.PhoneHashes) {
+		log.Printf("Stopping sequence for %s as they have opted out", contact.Key)
+		return false, workflow.ErrStop
+	}
+
+	switch condition {
+	case workflow.ConditionAlways:
+		return true, nil
+	case workflow.ConditionNotRegistered:
+		camp, err := r.s.campaigns.Get(contact.Campaign)
 		if err != nil {
-			log.Printf("Error creating short link: %v", err)
-			return
+			return false, err
 		}
 
-		// Send message via TextMagic
-		message := fmt.Sprintf("Hello %s! Finish signing up for DemocracyOS here: %s", firstName, shortLink)
-		if err := s.textMagicClient.SendMessage(contactID, message); err != nil {
-			log.Printf("Error sending message: %v", err)
-			return
+		existsInR2E, err := r.s.isRegistered(ctx, camp, contact.PhoneHashes)
+		if err != nil {
+			return false, fmt.Errorf("error checking R2E table: %w", err)
 		}
+		return !existsInR2E, nil
+	default:
+		return false, fmt.Errorf("unknown step condition %q", condition)
+	}
+}
 
-		log.Printf("Successfully sent reminder to %s %s", firstName, lastName)
-	} else {
-		log.Printf("Skipping message for %s as they already exist in the R2E table", phoneHash)
+// Send delivers a step's message; only SMS is supported
+func (r reminderRunner) Send(ctx context.Context, step workflow.Step, contact workflow.Contact) error {
+	if step.Channel != workflow.ChannelSMS {
+		return fmt.Errorf("unsupported channel %q", step.Channel)
+	}
+
+	camp, err := r.s.campaigns.Get(contact.Campaign)
+	if err != nil {
+		return err
 	}
+	return r.s.sendReminder(ctx, camp, step.Template, contact)
+}
+
+// The helpers below wrap vendor calls with the retry policy so transient
+// failures such as 429s, 5xx responses and dropped connections are retried.
+// Each attempt gets its own deadline so a hung vendor can't stall a worker.
+// Calls that create records or send messages are only repeated when the
+// vendor can't have acted on the failed attempt.
+
+func (s *landingSubmissionServiceImpl) getOrCreateContact(ctx context.Context, phone, firstName, lastName, listID string) (string, error) {
+	var contactID string
+	err := s.retryPolicy.Do(ctx, "TextMagic contact lookup", func() error {
+		callCtx, cancel := context.WithTimeout(ctx, vendorCallTimeout)
+		defer cancel()
+
+		var err error
+		contactID, err = s.textMagicClient.GetOrCreateContact(callCtx, phone, firstName, lastName, listID)
+		return err
+	})
+	return contactID, err
+}
+
+func (s *landingSubmissionServiceImpl) recordExists(ctx context.Context, table, field string, phoneHashes []string) (bool, error) {
+	var exists bool
+	err := s.retryPolicy.Do(ctx, "Airtable record check", func() error {
+		callCtx, cancel := context.WithTimeout(ctx, vendorCallTimeout)
+		defer cancel()
+
+		var err error
+		exists, err = s.airtableClient.RecordExists(callCtx, table, field, phoneHashes...)
+		return err
+	})
+	return exists, err
+}
+
+func (s *landingSubmissionServiceImpl) createRecord(ctx context.Context, table string, data map[string]interface{}) error {
+	return s.retryPolicy.DoNonIdempotent(ctx, "Airtable record creation", func() error {
+		callCtx, cancel := context.WithTimeout(ctx, vendorCallTimeout)
+		defer cancel()
+
+		return s.airtableClient.CreateRecord(callCtx, table, data)
+	})
+}
+
+func (s *landingSubmissionServiceImpl) createShortLink(ctx context.Context, originalURL string) (string, error) {
+	var shortLink string
+	err := s.retryPolicy.Do(ctx, "Short.io link creation", func() error {
+		callCtx, cancel := context.WithTimeout(ctx, vendorCallTimeout)
+		defer cancel()
+
+		var err error
+		shortLink, err = s.shortIOClient.CreateShortLink(callCtx, originalURL)
+		return err
+	})
+	return shortLink, err
+}
+
+func (s *landingSubmissionServiceImpl) sendMessage(ctx context.Context, contactID, message string) (string, error) {
+	var messageID string
+	err := s.retryPolicy.DoNonIdempotent(ctx, "TextMagic message send", func() error {
+		callCtx, cancel := context.WithTimeout(ctx, vendorCallTimeout)
+		defer cancel()
+
+		var err error
+		messageID, err = s.textMagicClient.SendMessage(callCtx, contactID, message)
+		return err
+	})
+	return messageID, err
 }
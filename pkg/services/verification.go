@@ -1,92 +1,329 @@
 package services
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
-	"sync"
+	"fmt"
+	"log"
 	"time"
 
 	"sample-golang/pkg/clients/twilio"
+	"sample-golang/pkg/utils"
 )
 
 var (
 	ErrVerificationExpired = errors.New("verification expired")
 	ErrInvalidCode         = errors.New("invalid verification code")
+	ErrTooManyAttempts     = errors.New("too many verification attempts")
+	ErrResendCooldown      = errors.New("verification code sent too recently")
+	ErrVerificationLocked  = errors.New("verification locked")
 )
 
+// VerificationError carries rate limit details alongside one of the errors above
+type VerificationError struct {
+	Err               error
+	RemainingAttempts int
+	RetryAfter        time.Duration
+}
+
+func (e *VerificationError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("%v, retry after %s", e.Err, e.RetryAfter.Round(time.Second))
+	}
+	return fmt.Sprintf("%v, %d attempts remaining", e.Err, e.RemainingAttempts)
+}
+
+func (e *VerificationError) Unwrap() error {
+	return e.Err
+}
+
+// VerificationLimits bounds how often a phone can be sent codes and guess them
+type VerificationLimits struct {
+	MaxAttempts     int
+	MaxSends        int
+	ResendCooldown  time.Duration
+	LockoutDuration time.Duration
+}
+
+// VerificationRequest says how to send a code to a phone. Channels are tried
+// in order until one succeeds, defaulting to SMS.
+type VerificationRequest struct {
+	Phone    string
+	Channels []twilio.Channel
+}
+
+// VerificationResult is returned once a code is confirmed
+type VerificationResult[T any] struct {
+	Data    T
+	Channel twilio.Channel
+}
+
+// Codec serializes the payload held with a verification so any store can persist it
+type Codec[T any] interface {
+	Encode(data T) ([]byte, error)
+	Decode(raw []byte) (T, error)
+}
+
+type jsonCodec[T any] struct{}
+
+// JSONCodec encodes payloads as JSON
+func JSONCodec[T any]() Codec[T] {
+	return jsonCodec[T]{}
+}
+
+func (jsonCodec[T]) Encode(data T) ([]byte, error) {
+	return json.Marshal(data)
+}
+
+func (jsonCodec[T]) Decode(raw []byte) (T, error) {
+	var data T
+	err := json.Unmarshal(raw, &data)
+	return data, err
+}
+
 type PendingVerification struct {
-	Phone     string
-	Data      interface{}
-	ExpiresAt time.Time
+	Phone       string         `json:"phone"`
+	Data        []byte         `json:"data"`
+	Channel     twilio.Channel `json:"channel"`
+	ExpiresAt   time.Time      `json:"expires_at"`
+	Attempts    int            `json:"attempts"`
+	Sends       int            `json:"sends"`
+	LastSentAt  time.Time      `json:"last_sent_at"`
+	LockedUntil time.Time      `json:"locked_until,omitempty"`
+	// Version is set by the store and changes with every write, so
+	// SaveIfUnchanged can tell whether the verification changed since Get
+	Version int64 `json:"-"`
+}
+
+// retainUntil is when a store may drop the verification, kept past expiry while locked
+func (v *PendingVerification) retainUntil() time.Time {
+	if v.LockedUntil.After(v.ExpiresAt) {
+		return v.LockedUntil
+	}
+	return v.ExpiresAt
 }
 
-type VerificationService struct {
+// VerificationService confirms phone numbers, holding a payload of type T until the code is checked
+type VerificationService[T any] struct {
 	twilioClient twilio.Client
-	pending      map[string]*PendingVerification
-	mu           sync.RWMutex
+	store        VerificationStore
+	codec        Codec[T]
+	phoneHasher  utils.PhoneHasher
 	timeout      time.Duration
+	limits       VerificationLimits
 }
 
-func NewVerificationService(twilioClient twilio.Client) *VerificationService {
-	return &VerificationService{
+func NewVerificationService[T any](twilioClient twilio.Client, store VerificationStore, codec Codec[T], phoneHasher utils.PhoneHasher, limits VerificationLimits) *VerificationService[T] {
+	return &VerificationService[T]{
 		twilioClient: twilioClient,
-		pending:      make(map[string]*PendingVerification),
+		store:        store,
+		codec:        codec,
+		phoneHasher:  phoneHasher,
 		timeout:      10 * time.Minute,
+		limits:       limits,
 	}
 }
 
-func (s *VerificationService) InitiateVerification(phone string, data interface{}) error {
-	if err := s.twilioClient.SendVerificationCode(phone); err != nil {
-		return err
+// InitiateVerification sends a code for req.Phone and returns the channel it was delivered on
+func (s *VerificationService[T]) InitiateVerification(ctx context.Context, req VerificationRequest, data T) (twilio.Channel, error) {
+	payload, err := s.codec.Encode(data)
+	if err != nil {
+		return "", fmt.Errorf("error encoding verification data: %w", err)
 	}
 
-	s.mu.Lock()
-	s.pending[phone] = &PendingVerification{
-		Phone:     phone,
-		Data:      data,
-		ExpiresAt: time.Now().Add(s.timeout),
+	phone := req.Phone
+	now := time.Now()
+	verification, err := s.store.Get(phone)
+	if err != nil {
+		return "", err
 	}
-	s.mu.Unlock()
 
-	// Start cleanup goroutine
-	go func() {
-		time.Sleep(s.timeout)
-		s.mu.Lock()
-		delete(s.pending, phone)
-		s.mu.Unlock()
-	}()
+	// Attempts carry over resends so requesting a new code doesn't reset the
+	// guess limit; they only start over once a lockout has ended
+	lockEnded := verification != nil && !verification.LockedUntil.IsZero() && !now.Before(verification.LockedUntil)
+	if verification == nil || lockEnded || now.After(verification.retainUntil()) {
+		fresh := &PendingVerification{Phone: phone}
+		if verification != nil {
+			fresh.Version = verification.Version
+		}
+		verification = fresh
+	}
 
-	return nil
+	if now.Before(verification.LockedUntil) {
+		return "", &VerificationError{Err: ErrVerificationLocked, RetryAfter: verification.LockedUntil.Sub(now)}
+	}
+
+	if wait := verification.LastSentAt.Add(s.limits.ResendCooldown).Sub(now); wait > 0 {
+		return "", &VerificationError{Err: ErrResendCooldown, RetryAfter: wait}
+	}
+
+	if verification.Sends >= s.limits.MaxSends {
+		return "", s.lock(verification, now)
+	}
+
+	// Reserve the send before making it, so concurrent requests can't all pass
+	// the checks above; a send that then fails still counts
+	verification.Data = payload
+	verification.ExpiresAt = now.Add(s.timeout)
+	verification.Sends++
+	verification.LastSentAt = now
+	reserved, err := s.store.SaveIfUnchanged(verification)
+	if err != nil {
+		return "", err
+	}
+	if !reserved {
+		return "", &VerificationError{Err: ErrResendCooldown, RetryAfter: max(s.limits.ResendCooldown, time.Second)}
+	}
+
+	channel, err := s.send(ctx, req)
+	if err != nil {
+		return "", err
+	}
+
+	// The channel is only reported back, so a newer send or a lockout wins over it
+	verification.Channel = channel
+	if _, err := s.store.SaveIfUnchanged(verification); err != nil {
+		log.Printf("Error saving verification channel: %v", err)
+	}
+	return channel, nil
 }
 
-func (s *VerificationService) VerifyCode(phone, code string) (interface{}, error) {
-	s.mu.RLock()
-	verification, exists := s.pending[phone]
-	s.mu.RUnlock()
+// send tries each requested channel in order and returns the first that delivers the code
+func (s *VerificationService[T]) send(ctx context.Context, req VerificationRequest) (twilio.Channel, error) {
+	channels := req.Channels
+	if len(channels) == 0 {
+		channels = []twilio.Channel{twilio.ChannelSMS}
+	}
+
+	var errs []error
+	for _, channel := range channels {
+		// The held data is released for the phone, so the code must go to it
+		if !channel.ReachesPhone() {
+			errs = append(errs, fmt.Errorf("%w: %s doesn't confirm a phone number", twilio.ErrUnsupportedChannel, channel))
+			continue
+		}
+		if err := channel.Validate(req.Phone); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		err := s.twilioClient.SendVerificationCode(ctx, req.Phone, channel)
+		if err == nil {
+			return channel, nil
+		}
+		if ctx.Err() != nil {
+			return "", err
+		}
 
-	if !exists {
+		log.Printf("Error sending verification code by %s, trying next channel: %v", channel, err)
+		errs = append(errs, err)
+	}
+
+	return "", fmt.Errorf("error sending verification code: %w", errors.Join(errs...))
+}
+
+// VerifyCode checks the code and returns the data passed to InitiateVerification.
+// Wrong codes return a *VerificationError with the attempts remaining before lockout.
+func (s *VerificationService[T]) VerifyCode(ctx context.Context, phone, code string) (*VerificationResult[T], error) {
+	verification, err := s.store.Get(phone)
+	if err != nil {
+		return nil, err
+	}
+
+	if verification == nil {
 		return nil, ErrVerificationExpired
 	}
 
-	if time.Now().After(verification.ExpiresAt) {
-		s.mu.Lock()
-		delete(s.pending, phone)
-		s.mu.Unlock()
+	now := time.Now()
+	if now.Before(verification.LockedUntil) {
+		return nil, &VerificationError{Err: ErrVerificationLocked, RetryAfter: verification.LockedUntil.Sub(now)}
+	}
+
+	if now.After(verification.ExpiresAt) {
+		if err := s.store.Delete(phone); err != nil {
+			log.Printf("Error deleting expired verification: %v", err)
+		}
 		return nil, ErrVerificationExpired
 	}
 
-	verified, err := s.twilioClient.CheckVerificationCode(phone, code)
+	if verification.Attempts >= s.limits.MaxAttempts {
+		return nil, s.lock(verification, now)
+	}
+
+	// Count the attempt atomically before checking so concurrent guesses can't skip the limit
+	attempts, err := s.store.IncrementAttempts(verification)
+	if err != nil {
+		return nil, err
+	}
+	if attempts == 0 {
+		return nil, ErrVerificationExpired
+	}
+	verification.Attempts = attempts
+	if attempts > s.limits.MaxAttempts {
+		return nil, s.lock(verification, now)
+	}
+
+	verified, err := s.twilioClient.CheckVerificationCode(ctx, phone, code)
 	if err != nil {
 		return nil, err
 	}
 
 	if !verified {
-		return nil, ErrInvalidCode
+		remaining := s.limits.MaxAttempts - verification.Attempts
+		if remaining <= 0 {
+			return nil, s.lock(verification, now)
+		}
+		return nil, &VerificationError{Err: ErrInvalidCode, RemainingAttempts: remaining}
+	}
+
+	if err := s.store.Delete(phone); err != nil {
+		return nil, err
+	}
+
+	data, err := s.codec.Decode(verification.Data)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding verification data: %w", err)
 	}
 
-	s.mu.Lock()
-	data := verification.Data
-	delete(s.pending, phone)
-	s.mu.Unlock()
+	return &VerificationResult[T]{
+		Data:    data,
+		Channel: verification.Channel,
+	}, nil
+}
+
+// lock blocks further sends and checks for the phone and discards the held data
+func (s *VerificationService[T]) lock(verification *PendingVerification, now time.Time) error {
+	log.Printf("Locking verification for %s after %d attempts and %d sends", ConsentKey(s.phoneHasher, verification.Phone), verification.Attempts, verification.Sends)
+
+	// Counters are left alone so guesses already in flight still count against the limit
+	verification.LockedUntil = now.Add(s.limits.LockoutDuration)
+	verification.Data = nil
+	if err := s.store.Save(verification); err != nil {
+		return err
+	}
 
-	return data, nil
+	return &VerificationError{Err: ErrTooManyAttempts, RetryAfter: s.limits.LockoutDuration}
+}
+
+// StartSweeper removes expired verifications every interval until ctx is done
+func (s *VerificationService[T]) StartSweeper(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				removed, err := s.store.DeleteExpired(time.Now())
+				if err != nil {
+					log.Printf("Error sweeping expired verifications: %v", err)
+				} else if removed > 0 {
+					log.Printf("Removed %d expired verifications", removed)
+				}
+			}
+		}
+	}()
 }
@@ -0,0 +1,582 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"sample-golang/pkg/clients/otp"
+	"sample-golang/pkg/resp"
+)
+
+// VerificationStore defines the interface for persisting pending verifications,
+// and the hashed codes sent for them when codes are generated locally.
+// Get returns nil without an error when no verification exists for the phone.
+type VerificationStore interface {
+	otp.CodeStore
+
+	// Save writes v over whatever is stored
+	Save(v *PendingVerification) error
+	// SaveIfUnchanged atomically writes v only if the stored verification is
+	// still at v.Version, or is gone, and reports whether it did. Writes and
+	// counted guesses all change the stored version.
+	SaveIfUnchanged(v *PendingVerification) (bool, error)
+	Get(phone string) (*PendingVerification, error)
+	// IncrementAttempts atomically counts a guess at v's code and returns the
+	// new total, or 0 if the verification no longer exists
+	IncrementAttempts(v *PendingVerification) (int, error)
+	Delete(phone string) error
+	DeleteExpired(now time.Time) (int, error)
+}
+
+type memoryVerificationStore struct {
+	pending map[string]*PendingVerification
+	codes   map[string]otp.Code
+	mu      sync.RWMutex
+}
+
+// NewMemoryVerificationStore creates a store that keeps verifications in process memory
+func NewMemoryVerificationStore() VerificationStore {
+	return &memoryVerificationStore{
+		pending: make(map[string]*PendingVerification),
+		codes:   make(map[string]otp.Code),
+	}
+}
+
+// Save and Get copy verifications so callers can't change them without saving
+func (s *memoryVerificationStore) Save(v *PendingVerification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	saved := *v
+	saved.Version = v.Version + 1
+	if current, ok := s.pending[v.Phone]; ok && current.Version >= saved.Version {
+		saved.Version = current.Version + 1
+	}
+	s.pending[v.Phone] = &saved
+	return nil
+}
+
+func (s *memoryVerificationStore) SaveIfUnchanged(v *PendingVerification) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if current, ok := s.pending[v.Phone]; ok && current.Version != v.Version {
+		return false, nil
+	}
+	v.Version++
+	saved := *v
+	s.pending[v.Phone] = &saved
+	return true, nil
+}
+
+func (s *memoryVerificationStore) Get(phone string) (*PendingVerification, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	v, ok := s.pending[phone]
+	if !ok {
+		return nil, nil
+	}
+	found := *v
+	return &found, nil
+}
+
+func (s *memoryVerificationStore) IncrementAttempts(v *PendingVerification) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.pending[v.Phone]
+	if !ok {
+		return 0, nil
+	}
+	current.Attempts++
+	current.Version++
+	return current.Attempts, nil
+}
+
+func (s *memoryVerificationStore) SaveCode(phone string, code otp.Code) error {
+	s.mu.Lock()
+	s.codes[phone] = code
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *memoryVerificationStore) GetCode(phone string) (*otp.Code, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	code, ok := s.codes[phone]
+	if !ok {
+		return nil, nil
+	}
+	return &code, nil
+}
+
+func (s *memoryVerificationStore) DeleteCode(phone string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.codes[phone]
+	delete(s.codes, phone)
+	return ok, nil
+}
+
+func (s *memoryVerificationStore) Delete(phone string) error {
+	s.mu.Lock()
+	delete(s.pending, phone)
+	delete(s.codes, phone)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *memoryVerificationStore) DeleteExpired(now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := 0
+	for phone, v := range s.pending {
+		if now.After(v.retainUntil()) {
+			delete(s.pending, phone)
+			removed++
+		}
+	}
+	for phone, code := range s.codes {
+		if now.After(code.ExpiresAt) {
+			delete(s.codes, phone)
+		}
+	}
+	return removed, nil
+}
+
+type sqlVerificationStore struct {
+	db *sql.DB
+}
+
+// NewSQLVerificationStore creates a store backed by Postgres or SQLite, opened
+// with the database package.
+func NewSQLVerificationStore(db *sql.DB) (VerificationStore, error) {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS pending_verifications (
+		phone TEXT PRIMARY KEY,
+		record TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		version BIGINT NOT NULL DEFAULT 0,
+		expires_at BIGINT NOT NULL
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("error creating pending_verifications table: %w", err)
+	}
+
+	// Attempts are kept in their own column so guesses can be counted
+	// atomically, and the version so writes can be made conditional
+	for _, column := range []string{"attempts INTEGER", "version BIGINT"} {
+		name := strings.Fields(column)[0]
+		if _, err := db.Exec(`SELECT ` + name + ` FROM pending_verifications WHERE 1 = 0`); err == nil {
+			continue
+		}
+		if _, err := db.Exec(`ALTER TABLE pending_verifications ADD COLUMN ` + column + ` NOT NULL DEFAULT 0`); err != nil {
+			return nil, fmt.Errorf("error adding %s column: %w", name, err)
+		}
+	}
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS verification_codes (
+		phone TEXT PRIMARY KEY,
+		code TEXT NOT NULL,
+		expires_at BIGINT NOT NULL
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("error creating verification_codes table: %w", err)
+	}
+
+	return &sqlVerificationStore{db: db}, nil
+}
+
+func (s *sqlVerificationStore) Save(v *PendingVerification) error {
+	record, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("error encoding verification: %w", err)
+	}
+
+	_, err = s.db.Exec(
+		`INSERT INTO pending_verifications (phone, record, attempts, version, expires_at) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (phone) DO UPDATE SET record = excluded.record, attempts = excluded.attempts,
+			version = pending_verifications.version + 1, expires_at = excluded.expires_at`,
+		v.Phone, string(record), v.Attempts, v.Version+1, v.retainUntil().Unix(),
+	)
+	if err != nil {
+		return fmt.Errorf("error saving verification: %w", err)
+	}
+	return nil
+}
+
+func (s *sqlVerificationStore) SaveIfUnchanged(v *PendingVerification) (bool, error) {
+	record, err := json.Marshal(v)
+	if err != nil {
+		return false, fmt.Errorf("error encoding verification: %w", err)
+	}
+
+	res, err := s.db.Exec(
+		`INSERT INTO pending_verifications (phone, record, attempts, version, expires_at) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (phone) DO UPDATE SET record = excluded.record, attempts = excluded.attempts,
+			version = excluded.version, expires_at = excluded.expires_at
+		WHERE pending_verifications.version = $6`,
+		v.Phone, string(record), v.Attempts, v.Version+1, v.retainUntil().Unix(), v.Version,
+	)
+	if err != nil {
+		return false, fmt.Errorf("error saving verification: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error saving verification: %w", err)
+	}
+	if n == 0 {
+		return false, nil
+	}
+	v.Version++
+	return true, nil
+}
+
+func (s *sqlVerificationStore) Get(phone string) (*PendingVerification, error) {
+	var record string
+	var attempts int
+	var version int64
+
+	err := s.db.QueryRow(
+		`SELECT record, attempts, version FROM pending_verifications WHERE phone = $1`, phone,
+	).Scan(&record, &attempts, &version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading verification: %w", err)
+	}
+
+	var v PendingVerification
+	if err := json.Unmarshal([]byte(record), &v); err != nil {
+		return nil, fmt.Errorf("error parsing verification: %w", err)
+	}
+	v.Attempts = attempts
+	v.Version = version
+	return &v, nil
+}
+
+func (s *sqlVerificationStore) IncrementAttempts(v *PendingVerification) (int, error) {
+	var attempts int
+	err := s.db.QueryRow(
+		`UPDATE pending_verifications SET attempts = attempts + 1, version = version + 1 WHERE phone = $1 RETURNING attempts`, v.Phone,
+	).Scan(&attempts)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error counting verification attempt: %w", err)
+	}
+	return attempts, nil
+}
+
+func (s *sqlVerificationStore) SaveCode(phone string, code otp.Code) error {
+	record, err := json.Marshal(code)
+	if err != nil {
+		return fmt.Errorf("error encoding verification code: %w", err)
+	}
+
+	_, err = s.db.Exec(
+		`INSERT INTO verification_codes (phone, code, expires_at) VALUES ($1, $2, $3)
+		ON CONFLICT (phone) DO UPDATE SET code = excluded.code, expires_at = excluded.expires_at`,
+		phone, string(record), code.ExpiresAt.Unix(),
+	)
+	if err != nil {
+		return fmt.Errorf("error saving verification code: %w", err)
+	}
+	return nil
+}
+
+func (s *sqlVerificationStore) GetCode(phone string) (*otp.Code, error) {
+	var record string
+	err := s.db.QueryRow(`SELECT code FROM verification_codes WHERE phone = $1`, phone).Scan(&record)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading verification code: %w", err)
+	}
+
+	var code otp.Code
+	if err := json.Unmarshal([]byte(record), &code); err != nil {
+		return nil, fmt.Errorf("error parsing verification code: %w", err)
+	}
+	return &code, nil
+}
+
+func (s *sqlVerificationStore) DeleteCode(phone string) (bool, error) {
+	res, err := s.db.Exec(`DELETE FROM verification_codes WHERE phone = $1`, phone)
+	if err != nil {
+		return false, fmt.Errorf("error deleting verification code: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error deleting verification code: %w", err)
+	}
+	return n > 0, nil
+}
+
+func (s *sqlVerificationStore) Delete(phone string) error {
+	if _, err := s.db.Exec(`DELETE FROM pending_verifications WHERE phone = $1`, phone); err != nil {
+		return fmt.Errorf("error deleting verification: %w", err)
+	}
+	if _, err := s.db.Exec(`DELETE FROM verification_codes WHERE phone = $1`, phone); err != nil {
+		return fmt.Errorf("error deleting verification code: %w", err)
+	}
+	return nil
+}
+
+func (s *sqlVerificationStore) DeleteExpired(now time.Time) (int, error) {
+	if _, err := s.db.Exec(`DELETE FROM verification_codes WHERE expires_at < $1`, now.Unix()); err != nil {
+		return 0, fmt.Errorf("error deleting expired verification codes: %w", err)
+	}
+
+	res, err := s.db.Exec(`DELETE FROM pending_verifications WHERE expires_at < $1`, now.Unix())
+	if err != nil {
+		return 0, fmt.Errorf("error deleting expired verifications: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error deleting expired verifications: %w", err)
+	}
+	return int(n), nil
+}
+
+type redisVerificationStore struct {
+	client resp.Client
+	prefix string
+}
+
+// NewRedisVerificationStore creates a store on a Redis-protocol server. Keys are
+// written with a TTL so the server expires them on its own. Attempts and the
+// version are kept in keys of their own so INCR can update them atomically.
+func NewRedisVerificationStore(client resp.Client, prefix string) VerificationStore {
+	return &redisVerificationStore{
+		client: client,
+		prefix: prefix,
+	}
+}
+
+func (s *redisVerificationStore) Save(v *PendingVerification) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("error encoding verification: %w", err)
+	}
+
+	ttl := time.Until(v.retainUntil()).Milliseconds()
+	if ttl <= 0 {
+		return nil
+	}
+
+	px := strconv.FormatInt(ttl, 10)
+	_, err = s.client.Watch(nil, func(resp.Conn) ([][]string, error) {
+		return [][]string{
+			{"SET", s.prefix + v.Phone, string(data), "PX", px},
+			{"SET", s.attemptsKey(v.Phone), strconv.Itoa(v.Attempts), "PX", px},
+			{"INCR", s.versionKey(v.Phone)},
+			{"PEXPIRE", s.versionKey(v.Phone), px},
+		}, nil
+	})
+	if err != nil {
+		return fmt.Errorf("error saving verification: %w", err)
+	}
+	return nil
+}
+
+// errVerificationChanged stops a conditional save whose version is stale
+var errVerificationChanged = errors.New("verification changed")
+
+func (s *redisVerificationStore) SaveIfUnchanged(v *PendingVerification) (bool, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return false, fmt.Errorf("error encoding verification: %w", err)
+	}
+
+	ttl := time.Until(v.retainUntil()).Milliseconds()
+	if ttl <= 0 {
+		return false, nil
+	}
+
+	px := strconv.FormatInt(ttl, 10)
+	key, versionKey := s.prefix+v.Phone, s.versionKey(v.Phone)
+	_, err = s.client.Watch([]string{key, versionKey}, func(conn resp.Conn) ([][]string, error) {
+		reply, err := conn.Do("MGET", key, versionKey)
+		if err != nil {
+			return nil, err
+		}
+		values, ok := reply.([]interface{})
+		if !ok || len(values) != 2 {
+			return nil, fmt.Errorf("unexpected reply %T", reply)
+		}
+
+		// Records saved before versions were kept count as version 0
+		version, _ := resp.Int(values[1], nil)
+		if values[0] != nil && version != v.Version {
+			return nil, errVerificationChanged
+		}
+
+		return [][]string{
+			{"SET", key, string(data), "PX", px},
+			{"SET", s.attemptsKey(v.Phone), strconv.Itoa(v.Attempts), "PX", px},
+			{"SET", versionKey, strconv.FormatInt(v.Version+1, 10), "PX", px},
+		}, nil
+	})
+	if errors.Is(err, errVerificationChanged) || errors.Is(err, resp.ErrConflict) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error saving verification: %w", err)
+	}
+	v.Version++
+	return true, nil
+}
+
+func (s *redisVerificationStore) Get(phone string) (*PendingVerification, error) {
+	reply, err := s.client.Do("MGET", s.prefix+phone, s.attemptsKey(phone), s.versionKey(phone))
+	if err != nil {
+		return nil, fmt.Errorf("error loading verification: %w", err)
+	}
+
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != 3 {
+		return nil, fmt.Errorf("error loading verification: unexpected reply %T", reply)
+	}
+
+	data, err := resp.String(values[0], nil)
+	if errors.Is(err, resp.ErrNil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading verification: %w", err)
+	}
+
+	var v PendingVerification
+	if err := json.Unmarshal([]byte(data), &v); err != nil {
+		return nil, fmt.Errorf("error parsing verification: %w", err)
+	}
+
+	// Verifications saved before attempts had their own key keep the count in the record
+	if attempts, err := resp.Int(values[1], nil); err == nil {
+		v.Attempts = int(attempts)
+	}
+	v.Version, _ = resp.Int(values[2], nil)
+	return &v, nil
+}
+
+// IncrementAttempts gives up after this many conflicting writes to the verification
+const redisIncrementRetries = 5
+
+func (s *redisVerificationStore) IncrementAttempts(v *PendingVerification) (int, error) {
+	key := s.prefix + v.Phone
+
+	// INCR would recreate keys that expired in the meantime, so the guess is
+	// only counted while the verification exists, and the keys get its expiry
+	expiry := strconv.FormatInt(v.retainUntil().UnixMilli(), 10)
+	for i := 0; i < redisIncrementRetries; i++ {
+		replies, err := s.client.Watch([]string{key}, func(conn resp.Conn) ([][]string, error) {
+			exists, err := resp.Int(conn.Do("EXISTS", key))
+			if err != nil || exists == 0 {
+				return nil, err
+			}
+			return [][]string{
+				{"INCR", s.attemptsKey(v.Phone)},
+				{"PEXPIREAT", s.attemptsKey(v.Phone), expiry},
+				{"INCR", s.versionKey(v.Phone)},
+				{"PEXPIREAT", s.versionKey(v.Phone), expiry},
+			}, nil
+		})
+		if errors.Is(err, resp.ErrConflict) {
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("error counting verification attempt: %w", err)
+		}
+		if replies == nil {
+			return 0, nil
+		}
+
+		attempts, err := resp.Int(replies[0], nil)
+		if err != nil {
+			return 0, fmt.Errorf("error counting verification attempt: %w", err)
+		}
+		return int(attempts), nil
+	}
+	return 0, fmt.Errorf("error counting verification attempt: %w", resp.ErrConflict)
+}
+
+func (s *redisVerificationStore) SaveCode(phone string, code otp.Code) error {
+	data, err := json.Marshal(code)
+	if err != nil {
+		return fmt.Errorf("error encoding verification code: %w", err)
+	}
+
+	ttl := time.Until(code.ExpiresAt).Milliseconds()
+	if ttl <= 0 {
+		return nil
+	}
+
+	if _, err := s.client.Do("SET", s.codeKey(phone), string(data), "PX", strconv.FormatInt(ttl, 10)); err != nil {
+		return fmt.Errorf("error saving verification code: %w", err)
+	}
+	return nil
+}
+
+func (s *redisVerificationStore) GetCode(phone string) (*otp.Code, error) {
+	data, err := resp.String(s.client.Do("GET", s.codeKey(phone)))
+	if errors.Is(err, resp.ErrNil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading verification code: %w", err)
+	}
+
+	var code otp.Code
+	if err := json.Unmarshal([]byte(data), &code); err != nil {
+		return nil, fmt.Errorf("error parsing verification code: %w", err)
+	}
+	return &code, nil
+}
+
+func (s *redisVerificationStore) DeleteCode(phone string) (bool, error) {
+	deleted, err := resp.Int(s.client.Do("DEL", s.codeKey(phone)))
+	if err != nil {
+		return false, fmt.Errorf("error deleting verification code: %w", err)
+	}
+	return deleted > 0, nil
+}
+
+func (s *redisVerificationStore) Delete(phone string) error {
+	if _, err := s.client.Do("DEL", s.prefix+phone, s.attemptsKey(phone), s.versionKey(phone), s.codeKey(phone)); err != nil {
+		return fmt.Errorf("error deleting verification: %w", err)
+	}
+	return nil
+}
+
+func (s *redisVerificationStore) attemptsKey(phone string) string {
+	return s.prefix + phone + ":attempts"
+}
+
+func (s *redisVerificationStore) versionKey(phone string) string {
+	return s.prefix + phone + ":version"
+}
+
+func (s *redisVerificationStore) codeKey(phone string) string {
+	return s.prefix + phone + ":code"
+}
+
+// DeleteExpired is a no-op because the server expires keys itself
+func (s *redisVerificationStore) DeleteExpired(now time.Time) (int, error) {
+	return 0, nil
+}
@@ -0,0 +1,243 @@
+package services
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"sample-golang/pkg/clients/otp"
+	"sample-golang/pkg/clients/twilio"
+	"sample-golang/pkg/database"
+	"sample-golang/pkg/resp"
+)
+
+// verificationStores returns a fresh instance of each store, the Redis one
+// running against the embedded stand-in
+func verificationStores(t *testing.T) map[string]VerificationStore {
+	t.Helper()
+
+	db, err := database.Open("sqlite:" + filepath.Join(t.TempDir(), "verifications.db"))
+	if err != nil {
+		t.Fatalf("database.Open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	sqlStore, err := NewSQLVerificationStore(db)
+	if err != nil {
+		t.Fatalf("NewSQLVerificationStore: %v", err)
+	}
+
+	server := resp.NewServer("")
+	addr, err := server.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	t.Cleanup(func() { server.Close() })
+	client, err := resp.NewClient(addr, "", 4)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	return map[string]VerificationStore{
+		"memory": NewMemoryVerificationStore(),
+		"sqlite": sqlStore,
+		"redis":  NewRedisVerificationStore(client, "verification:"),
+	}
+}
+
+// forEachVerificationStore runs test against each store implementation
+func forEachVerificationStore(t *testing.T, test func(t *testing.T, store VerificationStore)) {
+	for name, store := range verificationStores(t) {
+		t.Run(name, func(t *testing.T) {
+			test(t, store)
+		})
+	}
+}
+
+func TestVerificationStoreSaveGet(t *testing.T) {
+	forEachVerificationStore(t, func(t *testing.T, store VerificationStore) {
+		if got, err := store.Get(testPhone); err != nil || got != nil {
+			t.Fatalf("Get before Save = %v, %v, want nil", got, err)
+		}
+
+		want := PendingVerification{
+			Phone:      testPhone,
+			Data:       []byte(`"held"`),
+			Channel:    twilio.ChannelSMS,
+			ExpiresAt:  time.Now().Add(10 * time.Minute),
+			Attempts:   1,
+			Sends:      2,
+			LastSentAt: time.Now(),
+		}
+		if err := store.Save(&want); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+
+		got, err := store.Get(testPhone)
+		if err != nil || got == nil {
+			t.Fatalf("Get = %v, %v", got, err)
+		}
+		if string(got.Data) != string(want.Data) || got.Channel != want.Channel || got.Attempts != want.Attempts || got.Sends != want.Sends {
+			t.Errorf("Get = %+v, want %+v", *got, want)
+		}
+		if !got.ExpiresAt.Equal(want.ExpiresAt) || !got.LastSentAt.Equal(want.LastSentAt) {
+			t.Errorf("times = %s/%s, want %s/%s", got.ExpiresAt, got.LastSentAt, want.ExpiresAt, want.LastSentAt)
+		}
+
+		if err := store.Delete(testPhone); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		if got, err := store.Get(testPhone); err != nil || got != nil {
+			t.Errorf("Get after Delete = %v, %v, want nil", got, err)
+		}
+	})
+}
+
+func TestVerificationStoreIncrementAttempts(t *testing.T) {
+	forEachVerificationStore(t, func(t *testing.T, store VerificationStore) {
+		v := &PendingVerification{Phone: testPhone, ExpiresAt: time.Now().Add(10 * time.Minute), Attempts: 1}
+		if err := store.Save(v); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+
+		const guesses = 10
+		var wg sync.WaitGroup
+		for i := 0; i < guesses; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := store.IncrementAttempts(v); err != nil {
+					t.Errorf("IncrementAttempts: %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		got, err := store.Get(testPhone)
+		if err != nil || got == nil {
+			t.Fatalf("Get = %v, %v", got, err)
+		}
+		if got.Attempts != 1+guesses {
+			t.Errorf("Attempts = %d, want %d", got.Attempts, 1+guesses)
+		}
+	})
+}
+
+func TestVerificationStoreIncrementMissing(t *testing.T) {
+	for name, store := range verificationStores(t) {
+		attempts, err := store.IncrementAttempts(&PendingVerification{Phone: testPhone, ExpiresAt: time.Now().Add(time.Minute)})
+		if err != nil || attempts != 0 {
+			t.Errorf("%s: IncrementAttempts without a verification = %d, %v, want 0", name, attempts, err)
+		}
+	}
+}
+
+func TestVerificationStoreSaveIfUnchanged(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(store VerificationStore, read *PendingVerification) error
+		want   bool
+	}{
+		{"unchanged", func(VerificationStore, *PendingVerification) error { return nil }, true},
+		{"saved since", func(store VerificationStore, read *PendingVerification) error {
+			return store.Save(read)
+		}, false},
+		{"guessed since", func(store VerificationStore, read *PendingVerification) error {
+			_, err := store.IncrementAttempts(read)
+			return err
+		}, false},
+		{"deleted since", func(store VerificationStore, read *PendingVerification) error {
+			return store.Delete(read.Phone)
+		}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forEachVerificationStore(t, func(t *testing.T, store VerificationStore) {
+				if err := store.Save(&PendingVerification{Phone: testPhone, ExpiresAt: time.Now().Add(time.Minute)}); err != nil {
+					t.Fatalf("Save: %v", err)
+				}
+				read, err := store.Get(testPhone)
+				if err != nil || read == nil {
+					t.Fatalf("Get = %v, %v", read, err)
+				}
+				if err := tt.change(store, read); err != nil {
+					t.Fatalf("change: %v", err)
+				}
+
+				read.Sends++
+				saved, err := store.SaveIfUnchanged(read)
+				if err != nil || saved != tt.want {
+					t.Fatalf("SaveIfUnchanged = %v, %v, want %v", saved, err, tt.want)
+				}
+
+				// A save bumps the version, so the same read can't be saved twice
+				if saved {
+					stale := *read
+					stale.Version--
+					if again, err := store.SaveIfUnchanged(&stale); err != nil || again {
+						t.Errorf("SaveIfUnchanged with a stale version = %v, %v, want false", again, err)
+					}
+				}
+			})
+		})
+	}
+}
+
+func TestVerificationStoreCodes(t *testing.T) {
+	forEachVerificationStore(t, func(t *testing.T, store VerificationStore) {
+		code := otp.Code{Hash: []byte("hash"), Salt: []byte("salt"), ExpiresAt: time.Now().Add(time.Minute)}
+		if err := store.SaveCode(testPhone, code); err != nil {
+			t.Fatalf("SaveCode: %v", err)
+		}
+
+		got, err := store.GetCode(testPhone)
+		if err != nil || got == nil {
+			t.Fatalf("GetCode = %v, %v", got, err)
+		}
+		if string(got.Hash) != "hash" || string(got.Salt) != "salt" || !got.ExpiresAt.Equal(code.ExpiresAt) {
+			t.Errorf("GetCode = %+v, want %+v", *got, code)
+		}
+
+		// Deleting reports whether the code was there, which makes codes single use
+		for i, want := range []bool{true, false} {
+			deleted, err := store.DeleteCode(testPhone)
+			if err != nil || deleted != want {
+				t.Errorf("DeleteCode #%d = %v, %v, want %v", i+1, deleted, err, want)
+			}
+		}
+		if got, err := store.GetCode(testPhone); err != nil || got != nil {
+			t.Errorf("GetCode after DeleteCode = %v, %v, want nil", got, err)
+		}
+	})
+}
+
+func TestVerificationStoreDeleteExpired(t *testing.T) {
+	forEachVerificationStore(t, func(t *testing.T, store VerificationStore) {
+		now := time.Now()
+		records := map[string]time.Time{
+			"+15555550101": now.Add(-time.Minute),
+			"+15555550102": now.Add(time.Minute),
+		}
+		for phone, expiresAt := range records {
+			if err := store.Save(&PendingVerification{Phone: phone, ExpiresAt: expiresAt}); err != nil {
+				t.Fatalf("Save: %v", err)
+			}
+		}
+
+		if _, err := store.DeleteExpired(now); err != nil {
+			t.Fatalf("DeleteExpired: %v", err)
+		}
+
+		for phone, expiresAt := range records {
+			got, err := store.Get(phone)
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			if wantKept := expiresAt.After(now); (got != nil) != wantKept {
+				t.Errorf("%s kept = %v, want %v", phone, got != nil, wantKept)
+			}
+		}
+	})
+}
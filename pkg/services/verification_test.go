@@ -0,0 +1,189 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"sample-golang/pkg/clients/twilio"
+	"sample-golang/pkg/utils"
+)
+
+const testPhone = "+15555550100"
+
+// fakeVerifyClient accepts code "123456" for any destination
+type fakeVerifyClient struct {
+	mu     sync.Mutex
+	sent   int
+	checks int
+}
+
+func (f *fakeVerifyClient) SendVerificationCode(ctx context.Context, to string, channel twilio.Channel) error {
+	f.mu.Lock()
+	f.sent++
+	f.mu.Unlock()
+	return nil
+}
+
+func (f *fakeVerifyClient) CheckVerificationCode(ctx context.Context, to, code string) (bool, error) {
+	f.mu.Lock()
+	f.checks++
+	f.mu.Unlock()
+	return code == "123456", nil
+}
+
+func newTestVerificationService(t *testing.T, client twilio.Client) *VerificationService[string] {
+	t.Helper()
+	return newTestVerificationServiceWithStore(t, client, NewMemoryVerificationStore())
+}
+
+func newTestVerificationServiceWithStore(t *testing.T, client twilio.Client, store VerificationStore) *VerificationService[string] {
+	t.Helper()
+	hasher, err := utils.NewPhoneHasher([]string{"v1:test"}, false)
+	if err != nil {
+		t.Fatalf("NewPhoneHasher: %v", err)
+	}
+	return NewVerificationService[string](client, store, JSONCodec[string](), hasher, VerificationLimits{
+		MaxAttempts:     3,
+		MaxSends:        2,
+		LockoutDuration: time.Hour,
+	})
+}
+
+func TestVerifyCode(t *testing.T) {
+	tests := []struct {
+		name    string
+		guesses []string
+		wantErr []error
+	}{
+		{
+			name:    "correct code",
+			guesses: []string{"123456"},
+			wantErr: []error{nil},
+		},
+		{
+			name:    "correct code after a wrong one",
+			guesses: []string{"000000", "123456"},
+			wantErr: []error{ErrInvalidCode, nil},
+		},
+		{
+			name:    "locked after the last attempt",
+			guesses: []string{"000000", "000000", "000000", "123456"},
+			wantErr: []error{ErrInvalidCode, ErrInvalidCode, ErrTooManyAttempts, ErrVerificationLocked},
+		},
+		{
+			name:    "code is single use",
+			guesses: []string{"123456", "123456"},
+			wantErr: []error{nil, ErrVerificationExpired},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestVerificationService(t, &fakeVerifyClient{})
+			if _, err := s.InitiateVerification(context.Background(), VerificationRequest{Phone: testPhone}, "held"); err != nil {
+				t.Fatalf("InitiateVerification: %v", err)
+			}
+
+			for i, guess := range tt.guesses {
+				result, err := s.VerifyCode(context.Background(), testPhone, guess)
+				if !errors.Is(err, tt.wantErr[i]) || (err != nil) != (tt.wantErr[i] != nil) {
+					t.Fatalf("guess %d: err = %v, want %v", i+1, err, tt.wantErr[i])
+				}
+				if err == nil && result.Data != "held" {
+					t.Errorf("guess %d: data = %q, want the held data", i+1, result.Data)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyCodeConcurrentGuesses(t *testing.T) {
+	client := &fakeVerifyClient{}
+	s := newTestVerificationService(t, client)
+	if _, err := s.InitiateVerification(context.Background(), VerificationRequest{Phone: testPhone}, "held"); err != nil {
+		t.Fatalf("InitiateVerification: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.VerifyCode(context.Background(), testPhone, "000000")
+		}()
+	}
+	wg.Wait()
+
+	if client.checks > 3 {
+		t.Errorf("checked %d guesses, want at most MaxAttempts", client.checks)
+	}
+}
+
+func TestInitiateVerification(t *testing.T) {
+	tests := []struct {
+		name     string
+		channels []twilio.Channel
+		wantErr  error
+	}{
+		{"defaults to SMS", nil, nil},
+		{"falls back to a phone channel", []twilio.Channel{twilio.ChannelEmail, twilio.ChannelCall}, nil},
+		{"email doesn't verify a phone", []twilio.Channel{twilio.ChannelEmail}, twilio.ErrUnsupportedChannel},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestVerificationService(t, &fakeVerifyClient{})
+			_, err := s.InitiateVerification(context.Background(), VerificationRequest{Phone: testPhone, Channels: tt.channels}, "held")
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestInitiateVerificationLimits(t *testing.T) {
+	s := newTestVerificationService(t, &fakeVerifyClient{})
+	s.limits.ResendCooldown = time.Hour
+
+	req := VerificationRequest{Phone: testPhone}
+	if _, err := s.InitiateVerification(context.Background(), req, "held"); err != nil {
+		t.Fatalf("InitiateVerification: %v", err)
+	}
+	if _, err := s.InitiateVerification(context.Background(), req, "held"); !errors.Is(err, ErrResendCooldown) {
+		t.Fatalf("resend during cooldown: err = %v, want ErrResendCooldown", err)
+	}
+
+	// Past the cooldown the send limit applies
+	s.limits.ResendCooldown = 0
+	if _, err := s.InitiateVerification(context.Background(), req, "held"); err != nil {
+		t.Fatalf("second send: %v", err)
+	}
+	if _, err := s.InitiateVerification(context.Background(), req, "held"); !errors.Is(err, ErrTooManyAttempts) {
+		t.Fatalf("send past the limit: err = %v, want ErrTooManyAttempts", err)
+	}
+}
+
+func TestInitiateVerificationConcurrentSends(t *testing.T) {
+	forEachVerificationStore(t, func(t *testing.T, store VerificationStore) {
+		client := &fakeVerifyClient{}
+		s := newTestVerificationServiceWithStore(t, client, store)
+		s.limits.ResendCooldown = time.Hour
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.InitiateVerification(context.Background(), VerificationRequest{Phone: testPhone}, "held")
+			}()
+		}
+		wg.Wait()
+
+		if client.sent != 1 {
+			t.Errorf("sent %d codes, want 1 within the cooldown", client.sent)
+		}
+	})
+}
@@ -0,0 +1,83 @@
+package templates
+
+import "unicode/utf16"
+
+// Encodings an SMS can be sent in
+const (
+	EncodingGSM7 = "GSM-7"
+	EncodingUCS2 = "UCS-2"
+)
+
+// Characters per segment. Multipart messages lose some of each segment to the
+// header that lets the handset reassemble them.
+const (
+	gsm7Single    = 160
+	gsm7Multipart = 153
+	ucs2Single    = 70
+	ucs2Multipart = 67
+)
+
+// gsm7Basic is the GSM 03.38 default alphabet; each character takes one septet
+var gsm7Basic = makeCharset("@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?" +
+	"¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà")
+
+// gsm7Extended characters are sent as an escape plus a septet, so they count twice
+var gsm7Extended = makeCharset("^{}\\[~]|€\f")
+
+func makeCharset(chars string) map[rune]bool {
+	set := make(map[rune]bool)
+	for _, r := range chars {
+		set[r] = true
+	}
+	return set
+}
+
+// Segments describes how a message will be split for sending
+type Segments struct {
+	Encoding string `json:"encoding"`
+	// Characters is the length in septets for GSM-7 or UTF-16 units for UCS-2
+	Characters int `json:"characters"`
+	Count      int `json:"segments"`
+}
+
+// Count works out the encoding of text and how many SMS segments it takes
+func Count(text string) Segments {
+	if len(NonGSM(text)) > 0 {
+		units := len(utf16.Encode([]rune(text)))
+		return Segments{Encoding: EncodingUCS2, Characters: units, Count: segmentCount(units, ucs2Single, ucs2Multipart)}
+	}
+
+	septets := 0
+	for _, r := range text {
+		septets++
+		if gsm7Extended[r] {
+			septets++
+		}
+	}
+	return Segments{Encoding: EncodingGSM7, Characters: septets, Count: segmentCount(septets, gsm7Single, gsm7Multipart)}
+}
+
+// NonGSM returns the distinct characters in text that GSM-7 can't encode
+func NonGSM(text string) []rune {
+	var found []rune
+	seen := make(map[rune]bool)
+	for _, r := range text {
+		if gsm7Basic[r] || gsm7Extended[r] || seen[r] {
+			continue
+		}
+		seen[r] = true
+		found = append(found, r)
+	}
+	return found
+}
+
+func segmentCount(length, single, multipart int) int {
+	switch {
+	case length == 0:
+		return 0
+	case length <= single:
+		return 1
+	default:
+		return (length + multipart - 1) / multipart
+	}
+}
@@ -0,0 +1,58 @@
+package templates
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCount(t *testing.T) {
+	tests := []struct {
+		name       string
+		text       string
+		encoding   string
+		characters int
+		count      int
+	}{
+		{"empty", "", EncodingGSM7, 0, 0},
+		{"short", "Reply STOP to opt out", EncodingGSM7, 21, 1},
+		{"one full segment", strings.Repeat("a", 160), EncodingGSM7, 160, 1},
+		{"just over one segment", strings.Repeat("a", 161), EncodingGSM7, 161, 2},
+		{"two full multipart segments", strings.Repeat("a", 306), EncodingGSM7, 306, 2},
+		{"three multipart segments", strings.Repeat("a", 307), EncodingGSM7, 307, 3},
+		{"accented GSM characters", "Café à Málaga", EncodingUCS2, 13, 1},
+		{"basic accents stay GSM-7", "Ñandù café", EncodingGSM7, 10, 1},
+		{"extended characters count twice", "{€}", EncodingGSM7, 6, 1},
+		{"extended characters push past a segment", strings.Repeat("a", 159) + "€", EncodingGSM7, 161, 2},
+		{"emoji switches to UCS-2", "Thanks 👍", EncodingUCS2, 9, 1},
+		{"one full UCS-2 segment", strings.Repeat("ł", 70), EncodingUCS2, 70, 1},
+		{"UCS-2 multipart", strings.Repeat("ł", 71), EncodingUCS2, 71, 2},
+		{"surrogate pairs count twice", strings.Repeat("👍", 35), EncodingUCS2, 70, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Count(tt.text)
+			want := Segments{Encoding: tt.encoding, Characters: tt.characters, Count: tt.count}
+			if got != want {
+				t.Errorf("Count(%q) = %+v, want %+v", tt.text, got, want)
+			}
+		})
+	}
+}
+
+func TestNonGSM(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Hello [world]", ""},
+		{"Málaga ółó", "áół"},
+		{"“quoted” — text", "“”—"},
+	}
+
+	for _, tt := range tests {
+		if got := string(NonGSM(tt.text)); got != tt.want {
+			t.Errorf("NonGSM(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package templates
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrUnknownTemplate is returned when a named template isn't defined
+var ErrUnknownTemplate = errors.New("unknown template")
+
+// Data is what a message template can refer to, e.g. {{.First}} or {{.Town}}
+type Data struct {
+	First    string
+	Last     string
+	Link     string
+	Town     string
+	Campaign string
+}
+
+// Message is a rendered template along with how it will be sent
+type Message struct {
+	Text string `json:"text"`
+	Segments
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// Sample returns placeholder data for previews and for checking templates at startup
+func Sample(town, campaign string) Data {
+	return Data{
+		First:    "Alex",
+		Last:     "Smith",
+		Link:     "https://short.link/AbC123",
+		Town:     town,
+		Campaign: campaign,
+	}
+}
+
+// inlineName is what text passed to Render is parsed as, kept out of the way of named templates
+const inlineName = "_inline"
+
+// legacyPlaceholders maps the placeholders used before text/template to fields
+var legacyPlaceholders = strings.NewReplacer(
+	"{first}", "{{.First}}",
+	"{last}", "{{.Last}}",
+	"{link}", "{{.Link}}",
+	"{town}", "{{.Town}}",
+)
+
+// Library renders message templates. Templates are text/template source and may
+// include named templates with {{template "name" .}}; a campaign's own named
+// templates take precedence over the shared ones.
+type Library interface {
+	// Render executes text for a campaign
+	Render(campaign, text string, data Data) (Message, error)
+	// RenderNamed executes a named template for a campaign
+	RenderNamed(campaign, name string, data Data) (Message, error)
+}
+
+type libraryImpl struct {
+	shared    *template.Template
+	campaigns map[string]*template.Template
+	// maxSegments is the segment count above which a warning is added
+	maxSegments int
+}
+
+// NewLibrary parses the shared named templates and each campaign's overrides
+func NewLibrary(shared map[string]string, campaigns map[string]map[string]string, maxSegments int) (Library, error) {
+	root, err := define(template.New("").Option("missingkey=error"), shared)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &libraryImpl{
+		shared:      root,
+		campaigns:   make(map[string]*template.Template),
+		maxSegments: maxSegments,
+	}
+
+	for slug, named := range campaigns {
+		if len(named) == 0 {
+			continue
+		}
+
+		clone, err := root.Clone()
+		if err != nil {
+			return nil, fmt.Errorf("error copying templates for campaign %s: %w", slug, err)
+		}
+		if l.campaigns[slug], err = define(clone, named); err != nil {
+			return nil, fmt.Errorf("campaign %s: %w", slug, err)
+		}
+	}
+	return l, nil
+}
+
+// define parses named templates into set
+func define(set *template.Template, named map[string]string) (*template.Template, error) {
+	for name, text := range named {
+		if _, err := set.New(name).Parse(legacyPlaceholders.Replace(text)); err != nil {
+			return nil, fmt.Errorf("error parsing template %s: %w", name, err)
+		}
+	}
+	return set, nil
+}
+
+func (l *libraryImpl) Render(campaign, text string, data Data) (Message, error) {
+	set := l.shared
+	if own, ok := l.campaigns[campaign]; ok {
+		set = own
+	}
+
+	// Parse into a copy so concurrent renders don't add to the shared set
+	t, err := set.Clone()
+	if err != nil {
+		return Message{}, fmt.Errorf("error copying templates: %w", err)
+	}
+	if _, err := t.New(inlineName).Parse(legacyPlaceholders.Replace(text)); err != nil {
+		return Message{}, fmt.Errorf("error parsing template: %w", err)
+	}
+
+	var out strings.Builder
+	if err := t.ExecuteTemplate(&out, inlineName, data); err != nil {
+		return Message{}, fmt.Errorf("error rendering template: %w", err)
+	}
+
+	msg := Message{Text: out.String(), Segments: Count(out.String())}
+	if msg.Encoding == EncodingUCS2 {
+		msg.Warnings = append(msg.Warnings, fmt.Sprintf("characters outside GSM-7 (%s) switch the message to UCS-2, which fits %d characters per segment instead of %d", string(NonGSM(msg.Text)), ucs2Single, gsm7Single))
+	}
+	if l.maxSegments > 0 && msg.Count > l.maxSegments {
+		msg.Warnings = append(msg.Warnings, fmt.Sprintf("message is %d segments, above the limit of %d", msg.Count, l.maxSegments))
+	}
+	return msg, nil
+}
+
+func (l *libraryImpl) RenderNamed(campaign, name string, data Data) (Message, error) {
+	set := l.shared
+	if own, ok := l.campaigns[campaign]; ok {
+		set = own
+	}
+	if set.Lookup(name) == nil {
+		return Message{}, fmt.Errorf("%w: %q", ErrUnknownTemplate, name)
+	}
+	return l.Render(campaign, fmt.Sprintf("{{template %q .}}", name), data)
+}
+
+// LoadFile reads named templates from a YAML or JSON file shaped like
+// {"templates": {"reminder": "Hi {{.First}}, ..."}}
+func LoadFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading templates file: %w", err)
+	}
+
+	var file struct {
+		Templates map[string]string `yaml:"templates"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("error parsing templates file: %w", err)
+	}
+	return file.Templates, nil
+}
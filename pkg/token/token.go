@@ -0,0 +1,133 @@
+package token
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrTokenExpired = errors.New("token expired")
+)
+
+// Claims identify a registrant to the downstream form flow
+type Claims struct {
+	First     string `json:"first"`
+	Last      string `json:"last"`
+	PhoneHash string `json:"id"`
+	// Campaign is the slug of the campaign whose form the link opens
+	Campaign  string `json:"campaign,omitempty"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// Service issues and verifies signed, expiring tokens for links we send registrants
+type Service interface {
+	Issue(claims Claims) (string, error)
+	// LinkParams returns the query parameters that identify a registrant in a form link
+	LinkParams(claims Claims) (url.Values, error)
+	// Verify checks a token's signature and expiry. Claims are returned along
+	// with ErrTokenExpired so callers can still tell whose link it was.
+	Verify(token string) (Claims, error)
+}
+
+type serviceImpl struct {
+	secrets  [][]byte
+	ttl      time.Duration
+	legacyID bool
+}
+
+// NewService creates a token service. Tokens are signed with the first secret
+// and verified against all of them so secrets can be rotated. With legacyID
+// set, links also carry the phone hash as "id" for forms that still read it.
+func NewService(secrets []string, ttl time.Duration, legacyID bool) (Service, error) {
+	s := &serviceImpl{ttl: ttl, legacyID: legacyID}
+	for _, secret := range secrets {
+		if secret == "" {
+			continue
+		}
+		s.secrets = append(s.secrets, []byte(secret))
+	}
+
+	// Every instance must verify links issued by the others, and after restarts
+	if len(s.secrets) == 0 {
+		return nil, errors.New("no token secrets configured")
+	}
+	return s, nil
+}
+
+// Issue returns "<payload>.<signature>", both base64url encoded. ExpiresAt is
+// set from the service's TTL if the caller leaves it zero.
+func (s *serviceImpl) Issue(claims Claims) (string, error) {
+	if claims.ExpiresAt == 0 {
+		claims.ExpiresAt = time.Now().Add(s.ttl).Unix()
+	}
+
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("error encoding token claims: %w", err)
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + sign(s.secrets[0], payload), nil
+}
+
+func (s *serviceImpl) LinkParams(claims Claims) (url.Values, error) {
+	token, err := s.Issue(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{}
+	params.Add("token", token)
+	if s.legacyID {
+		// Fillout forms compute the R2E hash from "id" until they use /api/tokens/verify
+		params.Add("id", claims.PhoneHash)
+	}
+	return params, nil
+}
+
+func (s *serviceImpl) Verify(token string) (Claims, error) {
+	payload, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return Claims{}, ErrInvalidToken
+	}
+
+	valid := false
+	for _, secret := range s.secrets {
+		if hmac.Equal([]byte(sign(secret, payload)), []byte(signature)) {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return Claims{}, ErrInvalidToken
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+
+	var claims Claims
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+
+	if time.Now().Unix() > claims.ExpiresAt {
+		return claims, ErrTokenExpired
+	}
+	return claims, nil
+}
+
+func sign(secret []byte, payload string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
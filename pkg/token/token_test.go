@@ -0,0 +1,97 @@
+package token
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestService(t *testing.T, secrets ...string) Service {
+	t.Helper()
+	s, err := NewService(secrets, time.Hour, false)
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	return s
+}
+
+func TestNewServiceRequiresSecret(t *testing.T) {
+	for _, secrets := range [][]string{nil, {""}} {
+		if _, err := NewService(secrets, time.Hour, false); err == nil {
+			t.Errorf("NewService(%q) succeeded, want an error", secrets)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	claims := Claims{First: "Ada", Last: "Lovelace", PhoneHash: "v1:abc", Campaign: "springfield"}
+	current := newTestService(t, "current")
+	token, err := current.Issue(claims)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	payload, signature, _ := strings.Cut(token, ".")
+	expired, err := current.Issue(Claims{PhoneHash: "v1:abc", ExpiresAt: time.Now().Add(-time.Minute).Unix()})
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		service Service
+		token   string
+		wantErr error
+	}{
+		{"valid", current, token, nil},
+		{"after rotation", newTestService(t, "next", "current"), token, nil},
+		{"retired secret", newTestService(t, "next"), token, ErrInvalidToken},
+		{"edited payload", current, payload + "x." + signature, ErrInvalidToken},
+		{"missing signature", current, payload, ErrInvalidToken},
+		{"expired", current, expired, ErrTokenExpired},
+		{"garbage", current, "not-a-token", ErrInvalidToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.service.Verify(tt.token)
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Fatalf("Verify: err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (got.First != claims.First || got.PhoneHash != claims.PhoneHash || got.Campaign != claims.Campaign) {
+				t.Errorf("Verify = %+v, want %+v", got, claims)
+			}
+		})
+	}
+}
+
+func TestLinkParams(t *testing.T) {
+	claims := Claims{PhoneHash: "v1:abc"}
+
+	tests := []struct {
+		legacyID bool
+		wantID   string
+	}{
+		{false, ""},
+		{true, "v1:abc"},
+	}
+
+	for _, tt := range tests {
+		s, err := NewService([]string{"secret"}, time.Hour, tt.legacyID)
+		if err != nil {
+			t.Fatalf("NewService: %v", err)
+		}
+
+		params, err := s.LinkParams(claims)
+		if err != nil {
+			t.Fatalf("LinkParams: %v", err)
+		}
+		if _, err := s.Verify(params.Get("token")); err != nil {
+			t.Errorf("legacyID=%v: token doesn't verify: %v", tt.legacyID, err)
+		}
+		if got := params.Get("id"); got != tt.wantID {
+			t.Errorf("legacyID=%v: id = %q, want %q", tt.legacyID, got, tt.wantID)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"15m", 15 * time.Minute, false},
+		{"36h", 36 * time.Hour, false},
+		{"1d", 24 * time.Hour, false},
+		{"2w", 14 * 24 * time.Hour, false},
+		{"1.5d", 0, true},
+		{"d", 0, true},
+		{"soon", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseDuration(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseDuration(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseDuration(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestDurationDecoding(t *testing.T) {
+	var fromJSON struct {
+		Delay Duration `json:"delay"`
+	}
+	if err := json.Unmarshal([]byte(`{"delay": "1d"}`), &fromJSON); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if fromJSON.Delay != Duration(24*time.Hour) {
+		t.Errorf("JSON delay = %s, want 24h", time.Duration(fromJSON.Delay))
+	}
+
+	var fromYAML struct {
+		Delay Duration `yaml:"delay"`
+	}
+	if err := yaml.Unmarshal([]byte("delay: 1d\n"), &fromYAML); err != nil {
+		t.Fatalf("yaml.Unmarshal: %v", err)
+	}
+	if fromYAML.Delay != fromJSON.Delay {
+		t.Errorf("YAML delay = %s, want the same as JSON", time.Duration(fromYAML.Delay))
+	}
+
+	if err := json.Unmarshal([]byte(`{"delay": 900}`), &fromJSON); err == nil {
+		t.Error("accepted a bare number")
+	}
+}
@@ -3,6 +3,7 @@ package utils
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"strings"
 )
 
 // HashString creates a SHA-256 hash of the input string
@@ -14,3 +15,10 @@ func HashString(input string) string {
 	// Return the hex-encoded hash
 	return hex.EncodeToString(h.Sum(nil))
 }
+
+// HashPhone is the unkeyed SHA-256 of an E.164 number without its "+". Records
+// written before numbers were normalized hashed the input exactly as submitted,
+// so they only match when it was entered as the same bare digits.
+func HashPhone(number string) string {
+	return HashString(strings.TrimPrefix(number, "+"))
+}
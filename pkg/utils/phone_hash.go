@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// PhoneHasher creates keyed hashes of phone numbers. Unlike a plain SHA-256,
+// they can't be reversed by hashing every possible number without the secret.
+type PhoneHasher interface {
+	// Hash returns the hash under the current key, e.g. "v2:1f3c..."
+	Hash(number string) string
+	// Candidates returns the hash under every active key, current first, for lookups
+	Candidates(number string) []string
+}
+
+type phoneHashKey struct {
+	version string
+	secret  []byte
+}
+
+type phoneHasherImpl struct {
+	keys   []phoneHashKey
+	legacy bool
+}
+
+// NewPhoneHasher creates a hasher from keys written as "<version>:<secret>", the
+// first being current. At least one key is required. With legacy set,
+// Candidates also returns the unkeyed HashPhone value so records written
+// before keys were introduced still match.
+func NewPhoneHasher(keys []string, legacy bool) (PhoneHasher, error) {
+	h := &phoneHasherImpl{legacy: legacy}
+
+	for i, key := range keys {
+		version, secret, ok := strings.Cut(key, ":")
+		if !ok || version == "" || secret == "" {
+			return nil, fmt.Errorf("invalid phone hash key %d, expected <version>:<secret>", i+1)
+		}
+		h.keys = append(h.keys, phoneHashKey{version: version, secret: []byte(secret)})
+	}
+
+	if len(h.keys) == 0 {
+		return nil, errors.New("no phone hash keys configured")
+	}
+	return h, nil
+}
+
+func (h *phoneHasherImpl) Hash(number string) string {
+	return h.keys[0].hash(number)
+}
+
+func (h *phoneHasherImpl) Candidates(number string) []string {
+	candidates := make([]string, 0, len(h.keys)+1)
+	for _, key := range h.keys {
+		candidates = append(candidates, key.hash(number))
+	}
+	if h.legacy {
+		candidates = append(candidates, HashPhone(number))
+	}
+	return candidates
+}
+
+func (k phoneHashKey) hash(number string) string {
+	mac := hmac.New(sha256.New, k.secret)
+	mac.Write([]byte(number))
+	return k.version + ":" + hex.EncodeToString(mac.Sum(nil))
+}
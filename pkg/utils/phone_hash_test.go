@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewPhoneHasher(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    []string
+		wantErr bool
+	}{
+		{"one key", []string{"v1:secret"}, false},
+		{"rotated keys", []string{"v2:new", "v1:old"}, false},
+		{"no keys", nil, true},
+		{"missing version", []string{":secret"}, true},
+		{"missing secret", []string{"v1:"}, true},
+	}
+
+	for _, tt := range tests {
+		_, err := NewPhoneHasher(tt.keys, false)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestPhoneHasherCandidates(t *testing.T) {
+	const number = "+15555550100"
+
+	tests := []struct {
+		name   string
+		legacy bool
+		want   []string
+	}{
+		{"keyed only", false, []string{"v2:", "v1:"}},
+		{"with legacy", true, []string{"v2:", "v1:", HashPhone(number)}},
+	}
+
+	for _, tt := range tests {
+		h, err := NewPhoneHasher([]string{"v2:new", "v1:old"}, tt.legacy)
+		if err != nil {
+			t.Fatalf("NewPhoneHasher: %v", err)
+		}
+
+		if got := h.Hash(number); !strings.HasPrefix(got, "v2:") {
+			t.Errorf("%s: Hash = %q, want the current key's version", tt.name, got)
+		}
+
+		got := h.Candidates(number)
+		if len(got) != len(tt.want) {
+			t.Fatalf("%s: Candidates = %v, want %d hashes", tt.name, got, len(tt.want))
+		}
+		for i, want := range tt.want {
+			if !strings.HasPrefix(got[i], want) {
+				t.Errorf("%s: candidate %d = %q, want prefix %q", tt.name, i, got[i], want)
+			}
+		}
+	}
+}
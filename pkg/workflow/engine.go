@@ -0,0 +1,347 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"sample-golang/pkg/scheduler"
+	"sample-golang/pkg/sendwindow"
+)
+
+// StepJobKind identifies scheduled sequence steps
+const StepJobKind = "workflow_step"
+
+// ErrStop can be returned by a Runner to end a contact's sequence early
+var ErrStop = errors.New("sequence stopped")
+
+// ErrUnknownSequence is returned when a sequence name isn't defined
+var ErrUnknownSequence = errors.New("unknown sequence")
+
+// Contact is the data a sequence carries between steps
+type Contact struct {
+	// Key identifies the contact, normally their phone hash
+	Key         string   `json:"key"`
+	Campaign    string   `json:"campaign,omitempty"`
+	PhoneHashes []string `json:"phone_hashes,omitempty"`
+	ConsentKey  string   `json:"consent_key,omitempty"`
+	Timezone    string   `json:"timezone,omitempty"` // Told from the number, for quiet hours
+	FirstName   string   `json:"first_name"`
+	LastName    string   `json:"last_name"`
+	ContactID   string   `json:"contact_id"`
+}
+
+// Runner evaluates step conditions and delivers step messages
+type Runner interface {
+	// Check reports whether a step with the given condition should be sent
+	Check(ctx context.Context, condition string, contact Contact) (bool, error)
+	Send(ctx context.Context, step Step, contact Contact) error
+}
+
+// Engine runs sequences for contacts on top of the job scheduler
+type Engine interface {
+	// SetRunner sets the runner used for steps; it must be called before the scheduler starts
+	SetRunner(runner Runner)
+	// Start begins a sequence for a contact. It does nothing if the contact is already in it.
+	Start(sequence string, contact Contact) error
+	// Cancel stops a contact's active sequence, or all of them if sequence is empty
+	Cancel(contactKey, sequence string) error
+	Progress(contactKey string) ([]Progress, error)
+}
+
+// stepPayload is the data persisted with a scheduled step
+type stepPayload struct {
+	Sequence string `json:"sequence"`
+	Step     int    `json:"step"`
+	// Run ties the step to one start of the sequence, so steps left over from
+	// a cancelled run don't fire if the contact is started again
+	Run     int64   `json:"run"`
+	Contact Contact `json:"contact"`
+}
+
+type engineImpl struct {
+	sequences map[string]Sequence
+	store     Store
+	scheduler scheduler.Scheduler
+	runner    Runner
+	window    sendwindow.Policy
+}
+
+// NewEngine validates the sequences and registers the step handler with the
+// scheduler. Steps that come due outside the send window wait for it to open.
+func NewEngine(sequences []Sequence, store Store, sched scheduler.Scheduler, window sendwindow.Policy) (Engine, error) {
+	e := &engineImpl{
+		sequences: make(map[string]Sequence),
+		store:     store,
+		scheduler: sched,
+		window:    window,
+	}
+
+	for _, seq := range sequences {
+		seq = seq.withDefaults()
+		if err := seq.validate(); err != nil {
+			return nil, err
+		}
+		if _, exists := e.sequences[seq.Name]; exists {
+			return nil, fmt.Errorf("sequence %s is defined more than once", seq.Name)
+		}
+		e.sequences[seq.Name] = seq
+	}
+
+	sched.Register(StepJobKind, e.runStep)
+	return e, nil
+}
+
+func (e *engineImpl) SetRunner(runner Runner) {
+	e.runner = runner
+}
+
+func (e *engineImpl) Start(sequence string, contact Contact) error {
+	seq, ok := e.sequences[sequence]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownSequence, sequence)
+	}
+
+	now := time.Now()
+	runAt := e.window.Next(contact.Campaign, contact.Timezone, now.Add(time.Duration(seq.Steps[0].Delay)))
+	started := false
+	err := e.store.Update(contact.Key, sequence, func(p *Progress, exists bool) (bool, error) {
+		started = !exists || p.Status != StatusActive
+		if !started {
+			return false, nil
+		}
+		*p = Progress{
+			ContactKey: contact.Key,
+			Sequence:   sequence,
+			Status:     StatusActive,
+			NextRunAt:  &runAt,
+			History:    []StepResult{},
+			StartedAt:  now,
+			UpdatedAt:  now,
+		}
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+	if !started {
+		log.Printf("%s is already in sequence %s", contact.Key, sequence)
+		return nil
+	}
+
+	// Progress is saved first so the step can't run before its progress exists
+	return e.scheduleStep(stepPayload{Sequence: sequence, Step: 0, Run: now.UnixNano(), Contact: contact}, runAt)
+}
+
+func (e *engineImpl) Cancel(contactKey, sequence string) error {
+	progress, err := e.store.ListByContact(contactKey)
+	if err != nil {
+		return err
+	}
+
+	cancelled := 0
+	for _, p := range progress {
+		if p.Status != StatusActive || (sequence != "" && p.Sequence != sequence) {
+			continue
+		}
+
+		// Read again in the update, as a step may have finished the sequence since
+		active := false
+		err := e.store.Update(contactKey, p.Sequence, func(p *Progress, exists bool) (bool, error) {
+			active = exists && p.Status == StatusActive
+			if !active {
+				return false, nil
+			}
+			p.Status = StatusCancelled
+			p.NextRunAt = nil
+			p.UpdatedAt = time.Now()
+			return true, nil
+		})
+		if err != nil {
+			return err
+		}
+		if !active {
+			continue
+		}
+		cancelled++
+
+		// A step that can't be removed, e.g. one already running, sees the new status and does nothing
+		if _, err := e.scheduler.Cancel(progressID(contactKey, p.Sequence)); err != nil {
+			log.Printf("Error removing scheduled steps for %s: %v", contactKey, err)
+		}
+	}
+
+	if cancelled == 0 {
+		return ErrProgressNotFound
+	}
+	log.Printf("Cancelled %d sequences for %s", cancelled, contactKey)
+	return nil
+}
+
+func (e *engineImpl) Progress(contactKey string) ([]Progress, error) {
+	return e.store.ListByContact(contactKey)
+}
+
+// scheduleStep schedules the step a payload names to run at runAt
+func (e *engineImpl) scheduleStep(payload stepPayload, runAt time.Time) error {
+	if _, err := e.scheduler.ScheduleKeyed(StepJobKind, progressID(payload.Contact.Key, payload.Sequence), runAt, payload); err != nil {
+		return fmt.Errorf("error scheduling %s step %d: %w", payload.Sequence, payload.Step+1, err)
+	}
+	return nil
+}
+
+// runStep checks and sends a due step, then schedules the one after it
+func (e *engineImpl) runStep(ctx context.Context, job scheduler.Job) error {
+	var payload stepPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return scheduler.Permanent(fmt.Errorf("error decoding workflow step payload: %w", err))
+	}
+
+	contact := payload.Contact
+	if !e.isDue(payload) {
+		log.Printf("Dropping %s step %d for %s as the sequence has moved on", payload.Sequence, payload.Step+1, contact.Key)
+		return nil
+	}
+
+	seq, ok := e.sequences[payload.Sequence]
+	if !ok || payload.Step >= len(seq.Steps) {
+		// The definition changed since the step was scheduled
+		e.finish(payload, StatusStopped, StepResult{Error: "step no longer defined"})
+		return scheduler.Permanent(fmt.Errorf("%w: %s step %d", ErrUnknownSequence, payload.Sequence, payload.Step+1))
+	}
+	step := seq.Steps[payload.Step]
+
+	// The step may be overdue, e.g. after downtime, and now fall in quiet hours
+	now := time.Now()
+	if next := e.window.Next(contact.Campaign, contact.Timezone, now); next.After(now) {
+		log.Printf("Deferring %s step %d for %s to %s", seq.Name, payload.Step+1, contact.Key, next.Format(time.RFC3339))
+		return e.advance(payload, payload.Step, next, nil)
+	}
+
+	result, stopped := e.runOne(ctx, step, contact)
+	if ctx.Err() != nil && !result.Sent {
+		// Shutdown interrupted the step; the scheduler releases the job to run
+		// again. A step that was sent is recorded below so it isn't sent twice.
+		return ctx.Err()
+	}
+	if stopped {
+		e.finish(payload, StatusStopped, result)
+		return nil
+	}
+
+	if payload.Step+1 == len(seq.Steps) {
+		e.finish(payload, StatusCompleted, result)
+		return nil
+	}
+
+	next := seq.Steps[payload.Step+1]
+	return e.advance(payload, payload.Step+1, time.Now().Add(time.Duration(next.Delay)), &result)
+}
+
+// advance points the progress of the payload's run at step index, due at the
+// first time the send window allows at or after earliest, and schedules that
+// step. result, if set, is recorded for the step that just ran. Nothing
+// happens if the sequence has moved on, e.g. because it was cancelled.
+func (e *engineImpl) advance(payload stepPayload, index int, earliest time.Time, result *StepResult) error {
+	contact := payload.Contact
+	runAt := e.window.Next(contact.Campaign, contact.Timezone, earliest)
+
+	current := false
+	err := e.store.Update(contact.Key, payload.Sequence, func(p *Progress, exists bool) (bool, error) {
+		current = exists && p.waitingOn(payload)
+		if !current {
+			return false, nil
+		}
+		if result != nil {
+			p.History = append(p.History, *result)
+		}
+		p.NextStep = index
+		p.NextRunAt = &runAt
+		p.UpdatedAt = time.Now()
+		return true, nil
+	})
+	if err != nil || !current {
+		return err
+	}
+
+	payload.Step = index
+	return e.scheduleStep(payload, runAt)
+}
+
+// runOne evaluates a step's condition and sends it if the condition holds.
+// stopped reports that the runner returned ErrStop; other errors are recorded
+// and the sequence moves on, as one lost reminder shouldn't hold up the rest.
+func (e *engineImpl) runOne(ctx context.Context, step Step, contact Contact) (result StepResult, stopped bool) {
+	result = StepResult{Step: step.Name, At: time.Now()}
+	if e.runner == nil {
+		result.Error = "no runner configured"
+		return result, false
+	}
+
+	send, err := e.runner.Check(ctx, step.Condition, contact)
+	if err == nil && !send {
+		log.Printf("Skipping %s for %s as the %s condition doesn't hold", step.Name, contact.Key, step.Condition)
+		result.Skipped = step.Condition
+		return result, false
+	}
+	if err == nil {
+		err = e.runner.Send(ctx, step, contact)
+	}
+
+	switch {
+	case errors.Is(err, ErrStop):
+		result.Error = err.Error()
+		return result, true
+	case err != nil:
+		log.Printf("Error running %s for %s: %v", step.Name, contact.Key, err)
+		result.Error = err.Error()
+		return result, false
+	}
+
+	result.Sent = true
+	return result, false
+}
+
+// isDue reports whether the contact's progress is still waiting on this step
+func (e *engineImpl) isDue(payload stepPayload) bool {
+	p, err := e.store.Get(payload.Contact.Key, payload.Sequence)
+	if err != nil {
+		if !errors.Is(err, ErrProgressNotFound) {
+			log.Printf("Error loading progress for %s: %v", payload.Contact.Key, err)
+		}
+		return false
+	}
+	return p.waitingOn(payload)
+}
+
+// finish records the last result and moves the payload's run, if still on its
+// step, to a final status
+func (e *engineImpl) finish(payload stepPayload, status Status, result StepResult) {
+	contactKey := payload.Contact.Key
+	if result.At.IsZero() {
+		result.At = time.Now()
+	}
+
+	finished := false
+	err := e.store.Update(contactKey, payload.Sequence, func(p *Progress, exists bool) (bool, error) {
+		finished = exists && p.waitingOn(payload)
+		if !finished {
+			return false, nil
+		}
+		p.History = append(p.History, result)
+		p.Status = status
+		p.NextRunAt = nil
+		p.UpdatedAt = time.Now()
+		return true, nil
+	})
+	if err != nil {
+		log.Printf("Error saving progress for %s: %v", contactKey, err)
+		return
+	}
+	if finished {
+		log.Printf("Sequence %s for %s is %s", payload.Sequence, contactKey, status)
+	}
+}
@@ -0,0 +1,129 @@
+package workflow
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"sample-golang/pkg/docstore"
+	"sample-golang/pkg/scheduler"
+	"sample-golang/pkg/sendwindow"
+)
+
+// sendFunc is a Runner whose steps always apply and are sent by calling the func
+type sendFunc func(ctx context.Context, step Step, contact Contact) error
+
+func (f sendFunc) Check(ctx context.Context, condition string, contact Contact) (bool, error) {
+	return true, nil
+}
+
+func (f sendFunc) Send(ctx context.Context, step Step, contact Contact) error {
+	return f(ctx, step, contact)
+}
+
+// newTestEngine creates an engine for a two step sequence whose scheduler is
+// never started, so tests run steps themselves
+func newTestEngine(t *testing.T) (*engineImpl, scheduler.Store) {
+	t.Helper()
+	backend, err := docstore.NewFileBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileBackend: %v", err)
+	}
+	jobs := scheduler.NewDocStore(backend)
+	window, err := sendwindow.NewPolicy(sendwindow.Window{}, nil)
+	if err != nil {
+		t.Fatalf("NewPolicy: %v", err)
+	}
+
+	steps := []Step{
+		{Name: "first", Template: "Hi", Condition: ConditionAlways},
+		{Name: "second", Template: "Hi again", Condition: ConditionAlways},
+	}
+	e, err := NewEngine([]Sequence{{Name: "test", Steps: steps}}, NewStore(backend), scheduler.NewScheduler(jobs, time.Minute), window)
+	if err != nil {
+		t.Fatalf("NewEngine: %v", err)
+	}
+	return e.(*engineImpl), jobs
+}
+
+// runNext runs the contact's scheduled step
+func runNext(t *testing.T, ctx context.Context, e *engineImpl, jobs scheduler.Store, contactKey string) error {
+	t.Helper()
+	all, err := jobs.List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	for _, job := range all {
+		if job.Key == progressID(contactKey, "test") {
+			return e.runStep(ctx, job)
+		}
+	}
+	t.Fatalf("no step scheduled for %s", contactKey)
+	return nil
+}
+
+func TestRunStepRecordsSendOnShutdown(t *testing.T) {
+	e, jobs := newTestEngine(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sends := 0
+	e.SetRunner(sendFunc(func(ctx context.Context, step Step, contact Contact) error {
+		sends++
+		cancel()
+		return nil
+	}))
+	if err := e.Start("test", Contact{Key: "contact"}); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	if err := runNext(t, ctx, e, jobs, "contact"); err != nil {
+		t.Fatalf("runStep = %v, want the sent step recorded", err)
+	}
+
+	p, err := e.store.Get("contact", "test")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if p.NextStep != 1 || len(p.History) != 1 || !p.History[0].Sent {
+		t.Errorf("progress = step %d with history %+v, want step 1 after a sent first step", p.NextStep, p.History)
+	}
+
+	// The job now holds the second step, so the first isn't sent again
+	if err := runNext(t, context.Background(), e, jobs, "contact"); err != nil {
+		t.Fatalf("runStep: %v", err)
+	}
+	if sends != 2 {
+		t.Errorf("sends = %d, want 2", sends)
+	}
+}
+
+func TestCancelDuringStep(t *testing.T) {
+	e, jobs := newTestEngine(t)
+	e.SetRunner(sendFunc(func(ctx context.Context, step Step, contact Contact) error {
+		// As if another instance cancelled the sequence while this step was sending
+		return e.Cancel(contact.Key, "")
+	}))
+	if err := e.Start("test", Contact{Key: "contact"}); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	if err := runNext(t, context.Background(), e, jobs, "contact"); err != nil {
+		t.Fatalf("runStep: %v", err)
+	}
+
+	p, err := e.store.Get("contact", "test")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if p.Status != StatusCancelled {
+		t.Errorf("Status = %s, want %s", p.Status, StatusCancelled)
+	}
+	all, err := jobs.List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(all) != 0 {
+		t.Errorf("%d steps still scheduled after the cancel", len(all))
+	}
+}
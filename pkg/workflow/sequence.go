@@ -0,0 +1,103 @@
+package workflow
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+
+	"sample-golang/pkg/utils"
+)
+
+// Conditions a step can require before it runs
+const (
+	// ConditionNotRegistered runs the step only if the contact isn't in the R2E table yet
+	ConditionNotRegistered = "not_registered"
+	// ConditionAlways runs the step unconditionally
+	ConditionAlways = "always"
+)
+
+// ChannelSMS sends a step as a text message, the default channel
+const ChannelSMS = "sms"
+
+// Sequence is an ordered series of messages sent to a contact
+type Sequence struct {
+	Name  string `yaml:"name"`
+	Steps []Step `yaml:"steps"`
+}
+
+// Step is one message in a sequence. Delay counts from the previous step, or
+// from the start of the sequence for the first step.
+type Step struct {
+	Name      string         `yaml:"name"`
+	Delay     utils.Duration `yaml:"delay"`
+	Condition string         `yaml:"condition"`
+	Channel   string         `yaml:"channel"`
+	// Template is a text/template rendered with the contact's details
+	Template string `yaml:"template"`
+}
+
+func (s Sequence) validate() error {
+	if s.Name == "" {
+		return errors.New("sequence is missing a name")
+	}
+	if len(s.Steps) == 0 {
+		return fmt.Errorf("sequence %s has no steps", s.Name)
+	}
+
+	for i, step := range s.Steps {
+		switch {
+		case step.Delay < 0:
+			return fmt.Errorf("sequence %s step %d has a negative delay", s.Name, i+1)
+		case step.Template == "":
+			return fmt.Errorf("sequence %s step %d is missing a template", s.Name, i+1)
+		case step.Condition != ConditionNotRegistered && step.Condition != ConditionAlways:
+			return fmt.Errorf("sequence %s step %d has unknown condition %q", s.Name, i+1, step.Condition)
+		case step.Channel != ChannelSMS:
+			return fmt.Errorf("sequence %s step %d has unsupported channel %q", s.Name, i+1, step.Channel)
+		}
+	}
+	return nil
+}
+
+// withDefaults fills in step fields left empty in the definition
+func (s Sequence) withDefaults() Sequence {
+	steps := make([]Step, len(s.Steps))
+	for i, step := range s.Steps {
+		if step.Name == "" {
+			step.Name = fmt.Sprintf("step-%d", i+1)
+		}
+		if step.Condition == "" {
+			step.Condition = ConditionNotRegistered
+		}
+		if step.Channel == "" {
+			step.Channel = ChannelSMS
+		}
+		steps[i] = step
+	}
+	s.Steps = steps
+	return s
+}
+
+// LoadFile reads sequences from a YAML or JSON file shaped like
+// {"sequences": [{"name": "...", "steps": [{"delay": "1d", "template": "..."}]}]}
+func LoadFile(path string) ([]Sequence, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading sequences file: %w", err)
+	}
+
+	// JSON is valid YAML, so one decoder handles both
+	var file struct {
+		Sequences []Sequence `yaml:"sequences"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("error parsing sequences file: %w", err)
+	}
+
+	for i := range file.Sequences {
+		file.Sequences[i] = file.Sequences[i].withDefaults()
+	}
+	return file.Sequences, nil
+}
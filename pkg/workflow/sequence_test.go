@@ -0,0 +1,37 @@
+package workflow
+
+import (
+	"testing"
+	"time"
+
+	"sample-golang/pkg/utils"
+)
+
+func TestSequenceValidate(t *testing.T) {
+	step := Step{Template: "Hi {{.FirstName}}", Condition: ConditionAlways}
+
+	tests := []struct {
+		name    string
+		modify  func(*Step)
+		wantErr bool
+	}{
+		{"defaults", func(s *Step) {}, false},
+		{"explicit sms", func(s *Step) { s.Channel = ChannelSMS }, false},
+		{"email", func(s *Step) { s.Channel = "email" }, true},
+		{"whatsapp", func(s *Step) { s.Channel = "whatsapp" }, true},
+		{"negative delay", func(s *Step) { s.Delay = utils.Duration(-time.Hour) }, true},
+		{"missing template", func(s *Step) { s.Template = "" }, true},
+		{"unknown condition", func(s *Step) { s.Condition = "sometimes" }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := step
+			tt.modify(&s)
+			seq := Sequence{Name: "test", Steps: []Step{s}}.withDefaults()
+			if err := seq.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
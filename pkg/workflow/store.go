@@ -0,0 +1,125 @@
+package workflow
+
+import (
+	"errors"
+	"time"
+
+	"sample-golang/pkg/docstore"
+)
+
+// Status is where a contact is in a sequence
+type Status string
+
+const (
+	StatusActive    Status = "active"
+	StatusCompleted Status = "completed"
+	StatusCancelled Status = "cancelled"
+	// StatusStopped means the runner ended the sequence early, e.g. on opt-out
+	StatusStopped Status = "stopped"
+)
+
+// ErrProgressNotFound is returned when a contact hasn't started a sequence
+var ErrProgressNotFound = errors.New("sequence progress not found")
+
+// StepResult records what happened when a step came due
+type StepResult struct {
+	Step    string    `json:"step"`
+	Sent    bool      `json:"sent"`
+	Skipped string    `json:"skipped,omitempty"`
+	Error   string    `json:"error,omitempty"`
+	At      time.Time `json:"at"`
+}
+
+// Progress tracks one contact's run through one sequence
+type Progress struct {
+	ContactKey string       `json:"contact_key"`
+	Sequence   string       `json:"sequence"`
+	Status     Status       `json:"status"`
+	NextStep   int          `json:"next_step"`
+	NextRunAt  *time.Time   `json:"next_run_at,omitempty"`
+	History    []StepResult `json:"history"`
+	StartedAt  time.Time    `json:"started_at"`
+	UpdatedAt  time.Time    `json:"updated_at"`
+}
+
+// waitingOn reports whether the progress is active and waiting on the payload's
+// step of the same run
+func (p *Progress) waitingOn(payload stepPayload) bool {
+	return p.Status == StatusActive && p.NextStep == payload.Step && p.StartedAt.UnixNano() == payload.Run
+}
+
+func progressID(contactKey, sequence string) string {
+	return contactKey + "/" + sequence
+}
+
+// Store defines the interface for persisting sequence progress
+type Store interface {
+	Save(p Progress) error
+	// Update calls fn with the contact's progress in the sequence, or the zero
+	// value and false if there is none, and saves it if fn returns true. fn may
+	// run more than once, as concurrent updates, such as a cancel on another
+	// instance, don't overwrite each other.
+	Update(contactKey, sequence string, fn func(p *Progress, exists bool) (bool, error)) error
+	Get(contactKey, sequence string) (Progress, error)
+	ListByContact(contactKey string) ([]Progress, error)
+	// List returns every contact's progress, for maintenance such as migrations
+	List() ([]Progress, error)
+	Delete(contactKey, sequence string) error
+}
+
+type storeImpl struct {
+	progress docstore.Collection[Progress]
+}
+
+// NewStore creates a store that keeps sequence progress in the "workflows" collection
+func NewStore(backend docstore.Backend) Store {
+	return &storeImpl{progress: docstore.NewCollection[Progress](backend, "workflows")}
+}
+
+func (s *storeImpl) Save(p Progress) error {
+	return s.progress.Put(progressID(p.ContactKey, p.Sequence), p)
+}
+
+func (s *storeImpl) Update(contactKey, sequence string, fn func(p *Progress, exists bool) (bool, error)) error {
+	return s.progress.Update(progressID(contactKey, sequence), fn)
+}
+
+func (s *storeImpl) Get(contactKey, sequence string) (Progress, error) {
+	p, err := s.progress.Get(progressID(contactKey, sequence))
+	if errors.Is(err, docstore.ErrNotFound) {
+		return Progress{}, ErrProgressNotFound
+	}
+	return p, err
+}
+
+func (s *storeImpl) ListByContact(contactKey string) ([]Progress, error) {
+	progress, err := s.progress.List(progressID(contactKey, ""))
+	if err != nil {
+		return nil, err
+	}
+
+	result := []Progress{}
+	for _, p := range progress {
+		if p.ContactKey == contactKey {
+			result = append(result, p)
+		}
+	}
+	return result, nil
+}
+
+func (s *storeImpl) List() ([]Progress, error) {
+	progress, err := s.progress.List("")
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Progress, 0, len(progress))
+	for _, p := range progress {
+		result = append(result, p)
+	}
+	return result, nil
+}
+
+func (s *storeImpl) Delete(contactKey, sequence string) error {
+	return s.progress.Delete(progressID(contactKey, sequence))
+}